@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"go-migrate/migrate"
+	"io"
+	"sync"
+	"time"
+)
+
+// eventWriter writes events as JSON lines for -json, one at a time since every project sends them
+type eventWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventWriter(w io.Writer) *eventWriter {
+	return &eventWriter{enc: json.NewEncoder(w)}
+}
+
+// Write writes e as one line
+func (w *eventWriter) Write(e migrate.Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(e); err != nil {
+		logger.Errorf("Could not write event: %v", err)
+	}
+}
+
+// Done writes the event ending the stream, with the counts of the summary
+func (w *eventWriter) Done(results migrate.Results, elapsed time.Duration) {
+	w.Write(migrate.Event{
+		Event:      "done",
+		Time:       time.Now(),
+		DurationMS: int64(elapsed / time.Millisecond),
+		Complete:   len(results),
+		Total:      len(results),
+		Failed:     len(results.Failed()),
+		Empty:      len(results.Empty()),
+	})
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"go-migrate/migrate"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// nameList is a flag that accepts comma-separated project names and can be repeated
+type nameList []string
+
+func (n *nameList) String() string {
+	return strings.Join(*n, ",")
+}
+
+func (n *nameList) Set(value string) error {
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			*n = append(*n, name)
+		}
+	}
+	return nil
+}
+
+// parseSince reads a time for -since, either as RFC3339 or as a duration before now
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// matchProjects keeps the projects whose name matches re
+func matchProjects(projects []migrate.Project, re *regexp.Regexp) ([]migrate.Project, error) {
+	matched := make([]migrate.Project, 0, len(projects))
+	for _, project := range projects {
+		if re.MatchString(project.Name) {
+			matched = append(matched, project)
+		}
+	}
+	// Like an unknown name in -only, a pattern that matches nothing is more likely a mistake than a wish to do nothing
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no project matches %s", re)
+	}
+	return matched, nil
+}
+
+// filterProjects keeps the projects named in only (or all of them if only is empty) minus any named in skip
+func filterProjects(projects []migrate.Project, only, skip nameList) ([]migrate.Project, error) {
+	known := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		known[project.Name] = true
+	}
+
+	for _, names := range []nameList{only, skip} {
+		for _, name := range names {
+			if !known[name] {
+				return nil, fmt.Errorf("unknown project %s", name)
+			}
+		}
+	}
+
+	include := make(map[string]bool, len(only))
+	for _, name := range only {
+		include[name] = true
+	}
+	exclude := make(map[string]bool, len(skip))
+	for _, name := range skip {
+		exclude[name] = true
+	}
+
+	filtered := make([]migrate.Project, 0, len(projects))
+	for _, project := range projects {
+		if len(include) > 0 && !include[project.Name] {
+			continue
+		}
+		if exclude[project.Name] {
+			continue
+		}
+		filtered = append(filtered, project)
+	}
+	return filtered, nil
+}
+
+// dropFiltered removes the names of projects that were filtered out of all from the depends_on of projects,
+// they are treated as already migrated; names that were never configured are kept for Validate to report
+func dropFiltered(projects, all []migrate.Project) []migrate.Project {
+	kept := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		kept[project.Name] = true
+	}
+	filtered := make(map[string]bool, len(all))
+	for _, project := range all {
+		if !kept[project.Name] {
+			filtered[project.Name] = true
+		}
+	}
+
+	dropped := make([]migrate.Project, 0, len(projects))
+	for _, project := range projects {
+		var deps []string
+		for _, dep := range project.DependsOn {
+			if !filtered[dep] {
+				deps = append(deps, dep)
+			}
+		}
+		project.DependsOn = deps
+		dropped = append(dropped, project)
+	}
+	return dropped
+}
+
+// listProjects prints a table of projects to w
+func listProjects(w io.Writer, projects []migrate.Project) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tSVN\tSTANDARD")
+	for _, project := range projects {
+		source := project.SVN
+		if project.Dump != "" {
+			source = "dump " + project.Dump
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%t\n", project.Name, source, project.Standard)
+	}
+	_ = tw.Flush()
+}
@@ -2,4 +2,7 @@ module go-migrate
 
 go 1.12
 
-require github.com/BurntSushi/toml v0.3.1
+require (
+	github.com/BurntSushi/toml v0.3.1
+	gopkg.in/yaml.v2 v2.4.0
+)
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type level int
+
+const (
+	// levelQuiet only prints errors and finished projects
+	levelQuiet level = iota
+	// levelNormal also prints each step as it starts
+	levelNormal
+	// levelVerbose also prints every command and its output
+	levelVerbose
+)
+
+// consoleLogger serializes console output from every migration and filters it by level
+// With progress enabled, the last line of the console is a progress bar and
+// only messages that are always printed scroll above it
+type consoleLogger struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level level
+
+	progress bool
+	status   string
+	complete int
+	total    int
+}
+
+var logger = &consoleLogger{out: os.Stdout, level: levelNormal}
+
+func (l *consoleLogger) logf(lvl level, format string, args ...interface{}) {
+	if l.level < lvl {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	msg := fmt.Sprintf(format, args...)
+	if !l.progress {
+		_, _ = fmt.Fprintln(l.out, msg)
+		return
+	}
+	if lvl > levelQuiet {
+		l.status = msg
+	} else {
+		_, _ = fmt.Fprintf(l.out, "\r\033[K%s\n", msg)
+	}
+	l.drawBar()
+}
+
+// Progress updates the progress bar, if enabled
+func (l *consoleLogger) Progress(complete, total int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.complete, l.total = complete, total
+	if l.progress {
+		l.drawBar()
+	}
+}
+
+// StopProgress removes the progress bar so regular output can resume
+func (l *consoleLogger) StopProgress() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.progress {
+		_, _ = fmt.Fprint(l.out, "\r\033[K")
+		l.progress = false
+	}
+}
+
+func (l *consoleLogger) drawBar() {
+	const width = 30
+	filled := 0
+	if l.total > 0 {
+		filled = width * l.complete / l.total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", width-filled)
+	_, _ = fmt.Fprintf(l.out, "\r\033[K[%s] %d/%d %s", bar, l.complete, l.total, l.status)
+}
+
+// Errorf is always printed
+func (l *consoleLogger) Errorf(format string, args ...interface{}) {
+	l.logf(levelQuiet, format, args...)
+}
+
+// Printf is always printed
+func (l *consoleLogger) Printf(format string, args ...interface{}) {
+	l.logf(levelQuiet, format, args...)
+}
+
+// Infof is printed unless quiet
+func (l *consoleLogger) Infof(format string, args ...interface{}) {
+	l.logf(levelNormal, format, args...)
+}
+
+// Debugf is only printed when verbose
+func (l *consoleLogger) Debugf(format string, args ...interface{}) {
+	l.logf(levelVerbose, format, args...)
+}
+
+// Verbose is whether command output should be echoed to the console
+func (l *consoleLogger) Verbose() bool {
+	return l.level >= levelVerbose
+}
+
+// Writer returns a writer to the console for streaming command output
+func (l *consoleLogger) Writer() io.Writer {
+	return l.out
+}
+
+// isTerminal is whether f is attached to a terminal rather than a file or pipe
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
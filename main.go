@@ -1,219 +1,356 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"flag"
 	"fmt"
-	"github.com/BurntSushi/toml"
-	"io/ioutil"
+	"go-migrate/migrate"
+	"net/http"
 	"os"
-	"os/exec"
-	"path"
-	"strings"
-	"sync"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
-type Project struct {
-	SVN      string `toml:"svn"`
-	Name     string `toml:"name"`
-	Standard bool   `toml:"std"`
-}
+var (
+	configFlag  = flag.String("config", "projects.toml", "Path to the projects config")
+	dryRunFlag  = flag.Bool("dry-run", false, "Print the commands that would run without running them")
+	verboseFlag = flag.Bool("v", false, "Print every command and its output")
+	quietFlag   = flag.Bool("quiet", false, "Only print errors and finished projects")
+	noProgress  = flag.Bool("no-progress", false, "Print plain lines instead of a progress bar")
+	tailFlag    = flag.String("tail", "", "Also print the git output of this project to the console")
+	updateFlag  = flag.Bool("update", false, "Fetch new SVN commits into projects that were already migrated")
+	sinceFlag   = flag.String("since", "", "With -update, skip projects without SVN commits since this RFC3339 time or duration ago, e.g. 24h")
+	deepenFlag  = flag.Bool("deepen", false, "Clone the full history of projects that were only cloned from their shallow_revisions")
+	resetFlag   = flag.Bool("reset", false, "Forget which projects earlier runs finished, so only their directories are checked")
+	forceFlag   = flag.Bool("force", false, "Remove projects that were already migrated and migrate them again")
+	failFast    = flag.Bool("fail-fast", false, "Stop every other migration as soon as one project fails")
+	checkFlag   = flag.Bool("check", false, "Validate the config and exit, without touching base_path or running git")
+	doctorFlag  = flag.Bool("doctor", false, "Check that git, git-svn, svn, base_path, users_path, and every svn url are usable, and exit")
+	reconcile   = flag.Bool("reconcile", false, "Compare the projects of the config with the directories in base_path and exit")
+	listFlag    = flag.Bool("list", false, "Print the configured projects and exit")
+	printConfig = flag.Bool("print-config", false, "Print the config as TOML the way a run would use it, after env expansion, svn_base, filtering, and defaults, and exit")
+	stdinFlag   = flag.Bool("stdin", false, "Read name=svnurl projects from stdin instead of the config, with an optional :std suffix")
+	jsonFlag    = flag.Bool("json", false, "Write an event per line of JSON to stdout as projects start and finish, everything else goes to stderr")
+	reportFlag  = flag.String("report", "", "Write a JSON summary of the run to this file")
+	scriptFlag  = flag.String("script-out", "", "Write every command of the run to this file as a shell script, also with -dry-run")
+	metricsFlag = flag.String("metrics-file", "", "Write Prometheus metrics of the run to this file, e.g. for the node exporter textfile collector")
+	assetsOnly  = flag.Bool("assets-only", false, "Write users.txt to base_path and exit without migrating")
+	serveFlag   = flag.String("serve", "", "Serve the status of the run as JSON at /status on this address, e.g. :8080")
+	cleanupOnly = flag.String("cleanup-only", "", "Only convert the refs of this already cloned project, e.g. to try cleanup scripts")
+	cleanFlag   = flag.Bool("clean-assets", false, "Remove the generated assets once every project is finished")
+	svnHomeFlag = flag.String("svn-home", "", "Use this SVN config directory instead of ~/.subversion, for its cached credentials")
+	orderedFlag = flag.Bool("ordered", false, "Print finished projects and the summary in config order once all are done, so runs can be diffed")
+	maxRuntime  = flag.Duration("max-runtime", 0, "Stop every migration once the run has taken this long, e.g. 6h, and exit with 124")
+	perHostFlag = flag.Int("concurrency-per-host", 0, "Migrate at most this many projects from the same SVN host at once, 0 is unlimited")
+	matchFlag   = flag.String("match", "", "Only migrate projects whose name matches this regular expression, e.g. ^team-a-")
+	onlyFlag    nameList
+	skipFlag    nameList
+)
 
-type Config struct {
-	BasePath  string    `toml:"base_path"`
-	UsersPath string    `toml:"users_path"`
-	BashPath  string    `toml:"bash_path"`
-	Projects  []Project `toml:"projects"`
+func init() {
+	flag.Var(&onlyFlag, "only", "Comma-separated project names to migrate, all others are ignored")
+	flag.Var(&skipFlag, "skip", "Comma-separated project names to leave out")
 }
 
-type Queue struct {
-	wg sync.WaitGroup
-	Complete int
-	Total int
-}
+func main() {
+	flag.Parse()
 
-func (q *Queue) Add(delta int) {
-	q.wg.Add(delta)
-	q.Total++
-}
+	switch {
+	case *verboseFlag && *quietFlag:
+		logger.Errorf("-v and -quiet can not be used together")
+		os.Exit(1)
+	case *verboseFlag:
+		logger.level = levelVerbose
+	case *quietFlag:
+		logger.level = levelQuiet
+	}
 
-func (q *Queue) Done() {
-	q.wg.Done()
-	q.Complete++
-}
+	// Everything meant for people moves out of the way of the events
+	console := os.Stdout
+	if *jsonFlag {
+		console = os.Stderr
+	}
+	logger.out = console
 
-var (
-	queue  = &Queue{}
-	mu     sync.Mutex
-	config Config
-)
+	if *forceFlag && *updateFlag {
+		logger.Errorf("-force and -update can not be used together")
+		os.Exit(1)
+	}
 
-func main() {
-	_, _ = toml.DecodeFile("projects.toml", &config)
+	var match *regexp.Regexp
+	if *matchFlag != "" {
+		var err error
+		match, err = regexp.Compile(*matchFlag)
+		if err != nil {
+			logger.Errorf("Could not parse -match: %v", err)
+			os.Exit(1)
+		}
+	}
 
-	if err := os.Chdir(config.BasePath); err != nil {
-		fmt.Printf("Could not change directory: %v\n", err)
-		os.Exit(1)
+	var svnHome string
+	if *svnHomeFlag != "" {
+		var err error
+		svnHome, err = filepath.Abs(*svnHomeFlag)
+		if err != nil {
+			logger.Errorf("Could not resolve -svn-home: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	if err := checkAssets(); err != nil {
-		fmt.Printf("Could not generate assets: %v\n", err)
-		os.Exit(1)
+	var since time.Time
+	if *sinceFlag != "" {
+		if !*updateFlag {
+			logger.Errorf("-since can only be used with -update")
+			os.Exit(1)
+		}
+		var err error
+		since, err = parseSince(*sinceFlag, time.Now())
+		if err != nil {
+			logger.Errorf("Could not parse -since: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	for _, project := range config.Projects {
-		queue.Add(1)
-		go migrate(project)
+	configPath, err := filepath.Abs(*configFlag)
+	if err != nil {
+		logger.Errorf("Could not resolve config path: %v", err)
+		os.Exit(1)
 	}
 
-	queue.wg.Wait()
-	fmt.Println("Migration finished...")
-}
+	// Projects from stdin don't need a config, defaults are used for everything else
+	var config migrate.Config
+	if _, err := os.Stat(configPath); err == nil {
+		unknown, err := migrate.LoadConfig(configPath, &config)
+		if err != nil {
+			logger.Errorf("Could not decode config %s: %v", configPath, err)
+			os.Exit(1)
+		}
+		for _, key := range unknown {
+			logger.Printf("Warning: unknown config key %s", key)
+		}
+	} else if !*stdinFlag {
+		logger.Errorf("Could not find config %s: %v", configPath, err)
+		os.Exit(1)
+	}
 
-func migrate(project Project) {
-	defer func() {
-		queue.Done()
-		fmt.Printf("[%d/%d] Finished migrating %s\n", queue.Complete, queue.Total, project.Name)
-	}()
+	if *stdinFlag {
+		config.Projects, err = migrate.ParseProjects(os.Stdin)
+		if err != nil {
+			logger.Errorf("Could not read projects from stdin: %v", err)
+			os.Exit(1)
+		}
+		if config.BasePath == "" {
+			config.BasePath = "."
+		}
+	}
 
-	if _, err := os.Stat(path.Join(config.BasePath, project.Name)); err == nil {
-		fmt.Printf("%s already exists, skipping...\n", project.Name)
+	for _, name := range config.ExpandEnv() {
+		logger.Printf("Warning: environment variable %s is not set", name)
+	}
+	config.DeriveURLs()
+
+	if *checkFlag {
+		if err := migrate.Validate(config); err != nil {
+			fmt.Printf("FAIL %s: %v\n", configPath, err)
+			os.Exit(1)
+		}
+		fmt.Printf("OK %s: %d projects\n", configPath, len(config.Projects))
 		return
 	}
 
-	std := ""
-	if project.Standard {
-		std = "-s"
+	// Orphans can only be told apart with every project of the config, so this comes before filtering
+	if *reconcile {
+		r, err := migrate.Reconcile(config)
+		if err != nil {
+			logger.Errorf("Could not reconcile: %v", err)
+			os.Exit(1)
+		}
+		printReconciliation(os.Stdout, r)
+		return
 	}
 
-	out, err := os.Create(path.Join(config.BasePath, fmt.Sprintf("%s.log", project.Name)))
+	all := config.Projects
+	config.Projects, err = filterProjects(config.Projects, onlyFlag, skipFlag)
+	if err == nil && match != nil {
+		config.Projects, err = matchProjects(config.Projects, match)
+	}
 	if err != nil {
-		fmt.Printf("Could not open log file for %s: %v\n", project.Name, err)
-		return
+		logger.Errorf("Could not filter projects: %v", err)
+		os.Exit(1)
 	}
-	defer out.Close()
+	config.Projects = dropFiltered(config.Projects, all)
 
-	// Migration
-	migration := exec.Command("git", "svn", "clone", project.SVN, "--authors-file=users.txt", "--no-metadata", "--prefix", std, project.Name)
-	migration.Stdout = out
-	migration.Stderr = out
-	_, _ = out.WriteString(fmt.Sprintf("%s\n", strings.Join(migration.Args, " ")))
-	fmt.Printf("Migrating %s...\n", project.Name)
-	if err := migration.Run(); err != nil {
-		fmt.Printf("Could not migrate %s: %v\n", project.Name, err)
-		return
+	if *tailFlag != "" {
+		if _, err := filterProjects(config.Projects, nameList{*tailFlag}, nil); err != nil {
+			logger.Errorf("Could not tail: %v", err)
+			os.Exit(1)
+		}
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
+	if *printConfig {
+		resolved, err := migrate.Resolve(config)
+		if err != nil {
+			logger.Errorf("Could not resolve the config: %v", err)
+			os.Exit(1)
+		}
+		// env values such as tokens are hidden like they are in the logs, from the whole config at once
+		// so none is split between writes
+		var buf bytes.Buffer
+		if err := migrate.WriteConfig(&buf, resolved); err != nil {
+			logger.Errorf("Could not print the config: %v", err)
+			os.Exit(1)
+		}
+		if _, err := migrate.Redact(os.Stdout, resolved).Write(buf.Bytes()); err != nil {
+			logger.Errorf("Could not print the config: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	if err := os.Chdir(path.Join(config.BasePath, project.Name)); err != nil {
-		fmt.Printf("Could not change directory: %v\n", err)
+	if *doctorFlag {
+		doctor := &migrate.Migrator{SVNConfigDir: svnHome}
+		failed := printChecks(os.Stdout, doctor.Doctor(context.Background(), config))
+		if failed > 0 {
+			fmt.Printf("%d checks failed\n", failed)
+			os.Exit(1)
+		}
 		return
 	}
 
-	// Cleanup
-	// Tags
-	tags := exec.Command(config.BashPath, path.Join(config.BasePath, "tags.sh"))
-	tags.Stdout = out
-	tags.Stderr = out
-	_, _ = out.WriteString(fmt.Sprintf("%s\n", strings.Join(tags.Args, " ")))
-	fmt.Printf("Converting tags for %s...\n", project.Name)
-	if err := tags.Run(); err != nil {
-		fmt.Printf("Could not convert tags for %s: %v\n", project.Name, err)
-	}
-
-	// Branches
-	branches := exec.Command(config.BashPath, path.Join(config.BasePath, "branches.sh"))
-	branches.Stdout = out
-	branches.Stderr = out
-	_, _ = out.WriteString(fmt.Sprintf("%s\n", strings.Join(branches.Args, " ")))
-	fmt.Printf("Converting branches for %s...\n", project.Name)
-	if err := branches.Run(); err != nil {
-		fmt.Printf("Could not convert branches for %s: %v\n", project.Name, err)
-	}
-
-	// Peg-revisions
-	pegs := exec.Command(config.BashPath, path.Join(config.BasePath, "pegs.sh"))
-	pegs.Stdout = out
-	pegs.Stderr = out
-	_, _ = out.WriteString(fmt.Sprintf("%s\n", strings.Join(pegs.Args, " ")))
-	fmt.Printf("Converting peg-revisions for %s...\n", project.Name)
-	if err := pegs.Run(); err != nil {
-		fmt.Printf("Could not convert the peg-revisions for %s: %v\n", project.Name, err)
-	}
-
-	// Standard projects have a trunk branch, otherwise a git-svn branch
-	oldBranch := "git-svn"
-	if project.Standard {
-		oldBranch = "trunk"
-	}
-	old := exec.Command("git", "branch", "-d", oldBranch)
-	old.Stdout = out
-	old.Stderr = out
-	_, _ = out.WriteString(fmt.Sprintf("%s\n", strings.Join(old.Args, " ")))
-	fmt.Printf("Deleting the %s branch...\n", oldBranch)
-	if err := old.Run(); err != nil {
-		fmt.Printf("Could not delete the %s branch: %v\n", oldBranch, err)
-	}
-
-	if err := os.Chdir(config.BasePath); err != nil {
-		fmt.Printf("Could not change directory: %v\n", err)
+	if *listFlag {
+		listProjects(os.Stdout, config.Projects)
 		return
 	}
-}
 
-func checkAssets() error {
-	fit, err := os.Create(path.Join(config.BasePath, "tags.sh"))
-	if err != nil {
-		return err
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var interrupted int32
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		// Another interrupt goes back to the default of killing the process, in case stopping gets stuck
+		signal.Stop(signals)
+		logger.Printf("Received %s, stopping migrations, interrupt again to quit right away...", sig)
+		atomic.StoreInt32(&interrupted, 1)
+		cancel()
+	}()
+
+	// The deadline cancels rather than times out ctx, so projects don't mistake it for their own timeout
+	var deadlineExceeded int32
+	if *maxRuntime > 0 {
+		deadline := time.AfterFunc(*maxRuntime, func() {
+			logger.Printf("Reached the -max-runtime of %s, stopping migrations...", *maxRuntime)
+			atomic.StoreInt32(&deadlineExceeded, 1)
+			cancel()
+		})
+		defer deadline.Stop()
 	}
-	if _, err = fit.WriteString(tagsSh); err != nil {
-		return err
+
+	migrator := &migrate.Migrator{
+		DryRun:             *dryRunFlag,
+		Update:             *updateFlag,
+		Since:              since,
+		Force:              *forceFlag,
+		FailFast:           *failFast,
+		AssetsOnly:         *assetsOnly,
+		Reset:              *resetFlag,
+		Deepen:             *deepenFlag,
+		CleanAssets:        *cleanFlag,
+		Tail:               *tailFlag,
+		Logger:             logger,
+		Ordered:            *orderedFlag,
+		ConcurrencyPerHost: *perHostFlag,
+		SVNConfigDir:       svnHome,
 	}
-	defer fit.Close()
 
-	fib, err := os.Create(path.Join(config.BasePath, "branches.sh"))
-	if err != nil {
-		return err
+	var events *eventWriter
+	if *jsonFlag {
+		events = newEventWriter(os.Stdout)
+		migrator.OnEvent = events.Write
 	}
-	if _, err = fib.WriteString(branchesSh); err != nil {
-		return err
+
+	if *scriptFlag != "" {
+		script, err := createScript(*scriptFlag, config)
+		if err != nil {
+			logger.Errorf("Could not create the script: %v", err)
+			os.Exit(1)
+		}
+		defer script.Close()
+		migrator.Script = script
 	}
-	defer fib.Close()
 
-	fip, err := os.Create(path.Join(config.BasePath, "pegs.sh"))
-	if err != nil {
-		return err
+	if *cleanupOnly != "" {
+		if err := migrator.Cleanup(ctx, config, *cleanupOnly); err != nil {
+			logger.Errorf("Could not clean up %s: %v", *cleanupOnly, err)
+			os.Exit(1)
+		}
+		logger.Infof("Cleaned up %s", *cleanupOnly)
+		return
 	}
-	if _, err = fip.WriteString(pegsSh); err != nil {
-		return err
+
+	// Verbose, tailed, and dry-run output would be swallowed by the progress bar
+	logger.progress = isTerminal(console) && !*noProgress && !logger.Verbose() && *tailFlag == "" && !*dryRunFlag && !*assetsOnly
+	start := time.Now()
+
+	var server *http.Server
+	if *serveFlag != "" {
+		server = serveStatus(*serveFlag, migrator)
 	}
-	defer fip.Close()
 
-	fiup, err := os.Open(config.UsersPath)
+	results, err := migrator.Run(ctx, config)
+	if server != nil {
+		shutdown, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := server.Shutdown(shutdown); err != nil {
+			logger.Errorf("Could not stop the status server: %v", err)
+		}
+		cancelShutdown()
+	}
+	logger.StopProgress()
 	if err != nil {
-		return err
+		logger.Errorf("%v", err)
+		os.Exit(1)
 	}
-	defer fiup.Close()
+	if *assetsOnly {
+		return
+	}
+	elapsed := time.Since(start)
+	logger.Infof("Migration finished in %s...", elapsed.Round(time.Second))
 
-	users, err := ioutil.ReadAll(fiup)
-	if err != nil {
-		return err
+	if *reportFlag != "" {
+		if err := writeReport(*reportFlag, migrator.Report(), config); err != nil {
+			logger.Errorf("Could not write report: %v", err)
+		}
 	}
 
-	fiu, err := os.Create(path.Join(config.BasePath, "users.txt"))
-	if err != nil {
-		return err
+	if *metricsFlag != "" {
+		if err := writeMetrics(*metricsFlag, results, elapsed, config); err != nil {
+			logger.Errorf("Could not write metrics: %v", err)
+		}
 	}
-	if _, err = fiu.Write(users); err != nil {
-		return err
+
+	if events != nil {
+		events.Done(results, elapsed)
+	} else {
+		printSummary(os.Stdout, results, isTerminal(os.Stdout))
 	}
-	defer fiu.Close()
 
-	return nil
+	failed, empty, partial := results.Failed(), results.Empty(), results.Partial()
+	logger.Infof("%d succeeded, %d with cleanup errors, %d empty, %d failed", len(results)-len(failed)-len(empty)-len(partial), len(partial), len(empty), len(failed))
+	if atomic.LoadInt32(&interrupted) == 1 {
+		os.Exit(130)
+	}
+	if atomic.LoadInt32(&deadlineExceeded) == 1 {
+		logger.Errorf("Batch deadline of %s exceeded", *maxRuntime)
+		os.Exit(124)
+	}
+	if len(failed) > 0 {
+		os.Exit(1)
+	}
 }
-
-const (
-	tagsSh     = `for t in $(git for-each-ref --format='%(refname:short)' refs/remotes/tags); do git tag ${t/tags\//} $t && git branch -D -r $t; done`
-	branchesSh = `for b in $(git for-each-ref --format='%(refname:short)' refs/remotes); do git branch $b refs/remotes/$b && git branch -D -r $b; done`
-	pegsSh     = `for p in $(git for-each-ref --format='%(refname:short)' | grep @); do git branch -D $p; done`
-)
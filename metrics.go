@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go-migrate/migrate"
+	"os"
+	"strings"
+	"time"
+)
+
+// labelEscaper escapes label values for the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writeMetrics saves results to file in the Prometheus text format, for the node exporter textfile collector
+// The file is replaced in one rename, so the collector never reads it half written, and gets the file_mode of config
+func writeMetrics(file string, results migrate.Results, elapsed time.Duration, config migrate.Config) error {
+	var buf bytes.Buffer
+
+	_, _ = fmt.Fprintln(&buf, "# HELP migrate_project_success Whether the project migrated, 1 for migrated, partial, skipped, or empty and 0 for failed")
+	_, _ = fmt.Fprintln(&buf, "# TYPE migrate_project_success gauge")
+	for _, result := range results {
+		success := 1
+		if result.Err != nil {
+			success = 0
+		}
+		_, _ = fmt.Fprintf(&buf, "migrate_project_success{project=\"%s\"} %d\n", labelEscaper.Replace(result.Project.Name), success)
+	}
+
+	_, _ = fmt.Fprintln(&buf, "# HELP migrate_project_duration_seconds How long the project took to migrate")
+	_, _ = fmt.Fprintln(&buf, "# TYPE migrate_project_duration_seconds gauge")
+	for _, result := range results {
+		_, _ = fmt.Fprintf(&buf, "migrate_project_duration_seconds{project=\"%s\"} %g\n", labelEscaper.Replace(result.Project.Name), result.Duration().Seconds())
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Status()]++
+	}
+	_, _ = fmt.Fprintln(&buf, "# HELP migrate_projects The number of projects in the run by status")
+	_, _ = fmt.Fprintln(&buf, "# TYPE migrate_projects gauge")
+	for _, status := range []string{"migrated", "partial", "skipped", "empty", "failed"} {
+		_, _ = fmt.Fprintf(&buf, "migrate_projects{status=\"%s\"} %d\n", status, counts[status])
+	}
+
+	_, _ = fmt.Fprintln(&buf, "# HELP migrate_duration_seconds How long the whole run took")
+	_, _ = fmt.Fprintln(&buf, "# TYPE migrate_duration_seconds gauge")
+	_, _ = fmt.Fprintf(&buf, "migrate_duration_seconds %g\n", elapsed.Seconds())
+
+	_, _ = fmt.Fprintln(&buf, "# HELP migrate_last_run_timestamp_seconds When the run finished, as a unix timestamp")
+	_, _ = fmt.Fprintln(&buf, "# TYPE migrate_last_run_timestamp_seconds gauge")
+	_, _ = fmt.Fprintf(&buf, "migrate_last_run_timestamp_seconds %d\n", time.Now().Unix())
+
+	tmp := file + ".tmp"
+	if err := config.WriteFile(tmp, buf.Bytes()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
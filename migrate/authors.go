@@ -0,0 +1,146 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// generateUsers builds a users.txt skeleton from the committers of every project, with emails at domain
+func (m *Migrator) generateUsers(projects []Project, domain string) ([]byte, error) {
+	seen := make(map[string]bool)
+	for _, project := range projects {
+		m.Logger.Infof("Collecting authors for %s...", project.Name)
+		var authors []string
+		var err error
+		if project.Dump != "" {
+			authors, err = dumpAuthors(project.Dump)
+		} else {
+			authors, err = svnAuthors(withSVNConfigDir(withEnv(context.Background(), envList(m.projectEnv(project))), m.SVNConfigDir), project)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not collect authors for %s: %v", project.Name, err)
+		}
+		for _, author := range authors {
+			seen[author] = true
+		}
+	}
+
+	authors := make([]string, 0, len(seen))
+	for author := range seen {
+		authors = append(authors, author)
+	}
+	sort.Strings(authors)
+
+	var users bytes.Buffer
+	for _, author := range authors {
+		_, _ = fmt.Fprintf(&users, "%s = %s <%s@%s>\n", author, author, emailLocal(author), domain)
+	}
+	return users.Bytes(), nil
+}
+
+// authorDomain is the configured author_domain, falling back to the hostname or localhost
+func (m *Migrator) authorDomain() string {
+	if m.config.AuthorDomain != "" {
+		return m.config.AuthorDomain
+	}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		return host
+	}
+	return "localhost"
+}
+
+// svnAuthors returns the unique committers in the log of project
+func svnAuthors(ctx context.Context, project Project) ([]string, error) {
+	out, err := projectSVN(ctx, project, "log", "--quiet").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	// Lines look like "r123 | jdoe | 2019-01-01 12:00:00 -0500 (Tue, 01 Jan 2019)"
+	seen := make(map[string]bool)
+	var authors []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		parts := strings.Split(scanner.Text(), " | ")
+		if len(parts) < 3 || !strings.HasPrefix(parts[0], "r") {
+			continue
+		}
+		author := strings.TrimSpace(parts[1])
+		if !seen[author] {
+			seen[author] = true
+			authors = append(authors, author)
+		}
+	}
+	return authors, scanner.Err()
+}
+
+// emailLocal makes an SVN username safe to use as the local part of an email, e.g. "(no author)" becomes "no-author"
+func emailLocal(author string) string {
+	local := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r == ' ':
+			return '-'
+		}
+		return -1
+	}, author)
+	if local == "" {
+		return "unknown"
+	}
+	return local
+}
+
+// projectAuthorsFile is where the users_path of project is copied to in base_path
+func (m *Migrator) projectAuthorsFile(project Project) string {
+	return filepath.Join(m.config.BasePath, "users."+project.dirName()+".txt")
+}
+
+// copyProjectAuthors copies the users_path of every project that has its own into base_path, next to users.txt
+func (m *Migrator) copyProjectAuthors() error {
+	m.projectAuthors = make(map[string]string)
+	for _, project := range m.config.Projects {
+		if project.UsersPath == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(project.UsersPath)
+		if err != nil {
+			return fmt.Errorf("could not read the users_path of %s: %v", project.Name, err)
+		}
+		dst := m.projectAuthorsFile(project)
+		if err := m.config.writeFile(dst, data, m.config.fileMode(0644)); err != nil {
+			return err
+		}
+		m.projectAuthors[project.Name] = dst
+	}
+	return nil
+}
+
+// authorsFileOf is the authors file project is cloned with, its own copy if it has a users_path and users.txt if not
+func (m *Migrator) authorsFileOf(project Project) string {
+	if file, ok := m.projectAuthors[project.Name]; ok {
+		return file
+	}
+	return m.authorsFile
+}
+
+// cleanProjectAuthors removes the copies of the projects' own users_path, and then the cleanup scripts
+func (m *Migrator) cleanProjectAuthors() error {
+	for _, project := range m.config.Projects {
+		file, ok := m.projectAuthors[project.Name]
+		if !ok || file == project.UsersPath {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			return err
+		}
+	}
+	return m.cleanScripts()
+}
@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"os"
+	"path"
+)
+
+// Ways of choosing one of the base_paths for a project that hasn't been cloned yet
+const (
+	balanceRoundRobin = "round-robin"
+	balanceFreeSpace  = "free-space"
+)
+
+// repoBases are the directories repositories are cloned into, base_paths if there are any and otherwise base_path
+func (c Config) repoBases() []string {
+	if len(c.BasePaths) > 0 {
+		return c.BasePaths
+	}
+	return []string{c.BasePath}
+}
+
+// existingBase is the first of the repoBases that already has a directory for project, or empty if none has
+func (c Config) existingBase(project Project) string {
+	for _, base := range c.repoBases() {
+		if _, err := os.Stat(path.Join(base, c.projectPath(project))); err == nil {
+			return base
+		}
+	}
+	return ""
+}
+
+// findDir is the directory of project, where it already exists or else in the first of the repoBases
+// It is for looking at projects that should have been migrated already, the Migrator assigns new ones with projectDir
+func (c Config) findDir(project Project) string {
+	base := c.existingBase(project)
+	if base == "" {
+		base = c.repoBases()[0]
+	}
+	return path.Join(base, c.projectPath(project))
+}
+
+// baseOf is the base path project is cloned into, assigning one of the base_paths the first time it is asked for
+// Projects keep the base path they already have a directory in, so later runs find them again
+func (m *Migrator) baseOf(project Project) string {
+	if len(m.config.BasePaths) == 0 {
+		return m.config.BasePath
+	}
+	m.baseMu.Lock()
+	defer m.baseMu.Unlock()
+	if base, ok := m.bases[project.Name]; ok {
+		return base
+	}
+	base := m.config.existingBase(project)
+	if base == "" {
+		base = m.balance(project)
+	}
+	if m.bases == nil {
+		m.bases = make(map[string]string)
+	}
+	m.bases[project.Name] = base
+	return base
+}
+
+// balance picks one of the base_paths for a new project
+// free-space picks the one with the most space available as project starts, so projects starting at once can land together
+func (m *Migrator) balance(project Project) string {
+	if m.config.BalanceBy == balanceFreeSpace {
+		best, bestFree := "", uint64(0)
+		for _, base := range m.config.BasePaths {
+			free, err := freeBytes(base)
+			if err != nil {
+				m.Logger.Errorf("Could not check the free disk space of %s for %s: %v", base, project.Name, err)
+				continue
+			}
+			if best == "" || free > bestFree {
+				best, bestFree = base, free
+			}
+		}
+		if best != "" {
+			return best
+		}
+	}
+	base := m.config.BasePaths[m.nextBase%len(m.config.BasePaths)]
+	m.nextBase++
+	return base
+}
+
+// projectDir is the directory project is cloned into
+func (m *Migrator) projectDir(project Project) string {
+	return path.Join(m.baseOf(project), m.config.projectPath(project))
+}
@@ -0,0 +1,68 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// bundle writes the converted branches and tags of the repository in dir to <name>.bundle in the bundle_dir,
+// and returns its SHA-256, which is also written next to it as <name>.bundle.sha256 for sha256sum -c
+// The git-svn refs are left out, so the bundle only has what the recipient should end up with
+func (m *Migrator) bundle(ctx context.Context, project Project, dir string, out io.Writer) (file, sum string, err error) {
+	file = filepath.Join(m.config.BundleDir, project.dirName()+".bundle")
+	recordLine(ctx, "", "mkdir -p "+shellQuote(m.config.BundleDir)+" && rm -f "+shellQuote(file))
+	if !m.DryRun {
+		if err := os.MkdirAll(m.config.BundleDir, os.ModePerm); err != nil {
+			return "", "", err
+		}
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return "", "", err
+		}
+	}
+
+	args := []string{"bundle", "create", file, "--branches", "--tags"}
+	if m.config.MigrationNote {
+		args = append(args, notesRef)
+	}
+	if err := m.run(m.gitCommand(ctx, dir, args...), out); err != nil {
+		return "", "", err
+	}
+	if m.DryRun {
+		return file, "", nil
+	}
+	if m.config.FileMode != "" {
+		if err := os.Chmod(file, m.config.fileMode(0644)); err != nil {
+			return "", "", err
+		}
+	}
+
+	sum, err = sha256File(file)
+	if err != nil {
+		return "", "", err
+	}
+	line := fmt.Sprintf("%s  %s\n", sum, filepath.Base(file))
+	if err := m.config.writeFile(file+".sha256", []byte(line), m.config.fileMode(0644)); err != nil {
+		return "", "", err
+	}
+	_, _ = fmt.Fprintf(out, "Bundled to %s with SHA-256 %s\n", file, sum)
+	return file, sum, nil
+}
+
+// sha256File is the hex SHA-256 of the contents of file
+func sha256File(file string) (string, error) {
+	fi, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer fi.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, fi); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
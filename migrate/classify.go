@@ -0,0 +1,54 @@
+package migrate
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// classifyTail is how much of the end of a log is searched for a known error
+const classifyTail = 64 * 1024
+
+// signatures map messages svn and git svn print, in lower case, to the reason they are reported as
+// They are checked in order, so the more specific ones come first
+var signatures = []struct {
+	messages []string
+	reason   string
+}{
+	{[]string{"not defined in"}, "an author is missing from users.txt"},
+	{[]string{"e215004", "authorization failed", "authentication failed", "no more credentials"}, "svn authentication failed"},
+	{[]string{"e230001", "server certificate verification failed"}, "the svn server certificate is not trusted"},
+	{[]string{"e170013", "connection refused", "could not resolve host", "name or service not known", "unable to connect", "connection timed out"}, "the svn server is unreachable"},
+	{[]string{"malformed url", "illegal repository url", "unrecognized url scheme"}, "the svn url is malformed"},
+	{[]string{"e160013", "e170000", "path not found"}, "the svn url was not found"},
+	{[]string{"no space left on device"}, "the disk is full"},
+}
+
+// classifyLog guesses why a command failed from the end of the log at logPath
+// It returns an empty reason if nothing recognizable was logged, the log itself stays the source of truth
+func classifyLog(logPath string) string {
+	fi, err := os.Open(logPath)
+	if err != nil {
+		return ""
+	}
+	defer fi.Close()
+	if info, err := fi.Stat(); err == nil && info.Size() > classifyTail {
+		if _, err := fi.Seek(-classifyTail, io.SeekEnd); err != nil {
+			return ""
+		}
+	}
+	tail, err := ioutil.ReadAll(fi)
+	if err != nil {
+		return ""
+	}
+	lower := strings.ToLower(string(tail))
+	for _, sig := range signatures {
+		for _, msg := range sig.messages {
+			if strings.Contains(lower, msg) {
+				return sig.reason
+			}
+		}
+	}
+	return ""
+}
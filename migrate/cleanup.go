@@ -0,0 +1,80 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+)
+
+// Cleanup runs only the ref cleanup of the project called name in cfg, against the clone an earlier run left in base_path
+// It goes through the same steps as Run does after cloning, so custom cleanup scripts can be tried without cloning again
+// The output is appended to the log of the project
+func (m *Migrator) Cleanup(ctx context.Context, cfg Config, name string) error {
+	if m.Logger == nil {
+		m.Logger = nopLogger{}
+	}
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	cfg, err := resolveConfig(cfg)
+	if err != nil {
+		return err
+	}
+	m.config = cfg
+
+	var project Project
+	var found bool
+	for _, p := range cfg.Projects {
+		if p.Name == name {
+			project, found = p, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("no project is called %s", name)
+	}
+	dir := cfg.findDir(project)
+	if _, err := os.Stat(path.Join(dir, ".git", "svn")); err != nil {
+		return fmt.Errorf("%s is not a git-svn clone, migrate it first", dir)
+	}
+
+	if err := m.copyScripts(); err != nil {
+		return fmt.Errorf("could not copy the cleanup scripts: %v", err)
+	}
+
+	eventLog, err := cfg.openFile(path.Join(cfg.BasePath, "migration.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, cfg.fileMode(0644))
+	if err != nil {
+		return fmt.Errorf("could not open migration log: %v", err)
+	}
+	defer eventLog.Close()
+	m.events = log.New(eventLog, "", log.LstdFlags)
+
+	logPath := path.Join(cfg.LogDir, cfg.projectPath(project)+".log")
+	if err := os.MkdirAll(path.Dir(logPath), os.ModePerm); err != nil {
+		return err
+	}
+	logFile, err := cfg.openFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, cfg.fileMode(0644))
+	if err != nil {
+		return fmt.Errorf("could not open the log of %s: %v", project.Name, err)
+	}
+	defer logFile.Close()
+	var out io.Writer = logFile
+	if project.Name == m.Tail && !m.Logger.Verbose() {
+		out = io.MultiWriter(logFile, m.Logger.Writer())
+	}
+	env := m.projectEnv(project)
+	if secrets := envSecrets(env); len(secrets) > 0 {
+		out = &redactor{w: out, secrets: secrets}
+	}
+
+	ctx = withSVNConfigDir(withEnv(ctx, envList(env)), m.SVNConfigDir)
+	m.events.Printf("%s: cleanup only", project.Name)
+	_, _ = fmt.Fprintln(out, "Cleanup only")
+	if errs := m.cleanup(ctx, project, dir, out); len(errs) > 0 && m.config.StrictCleanup {
+		return cleanupError(errs)
+	}
+	return ctx.Err()
+}
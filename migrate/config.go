@@ -0,0 +1,342 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Project is one SVN repository to migrate
+type Project struct {
+	SVN              string            `toml:"svn" yaml:"svn"`
+	Dump             string            `toml:"dump" yaml:"dump"`
+	Name             string            `toml:"name" yaml:"name"`
+	Dir              string            `toml:"dir" yaml:"dir"`
+	Standard         bool              `toml:"std" yaml:"std"`
+	DetectLayout     *bool             `toml:"detect_layout" yaml:"detect_layout"`
+	Trunk            string            `toml:"trunk" yaml:"trunk"`
+	Branches         string            `toml:"branches" yaml:"branches"`
+	Tags             string            `toml:"tags" yaml:"tags"`
+	Prefix           string            `toml:"prefix" yaml:"prefix"`
+	Timeout          Duration          `toml:"timeout" yaml:"timeout"`
+	Username         string            `toml:"username" yaml:"username"`
+	PasswordEnv      string            `toml:"password_env" yaml:"password_env"`
+	UsersPath        string            `toml:"users_path" yaml:"users_path"`
+	Revision         string            `toml:"revision" yaml:"revision"`
+	ShallowRevisions int               `toml:"shallow_revisions" yaml:"shallow_revisions"`
+	IgnorePaths      string            `toml:"ignore_paths" yaml:"ignore_paths"`
+	ExcludeRefs      []string          `toml:"exclude_refs" yaml:"exclude_refs"`
+	ExtraArgs        []string          `toml:"extra_args" yaml:"extra_args"`
+	Env              map[string]string `toml:"env" yaml:"env"`
+	PreHook          []string          `toml:"pre_hook" yaml:"pre_hook"`
+	PostHook         []string          `toml:"post_hook" yaml:"post_hook"`
+	DependsOn        []string          `toml:"depends_on" yaml:"depends_on"`
+	Bare             bool              `toml:"bare" yaml:"bare"`
+}
+
+// password looks up the project's SVN password in the environment variable named by PasswordEnv
+// This keeps the password itself out of the config
+func (p Project) password() string {
+	if p.PasswordEnv == "" {
+		return ""
+	}
+	return os.Getenv(p.PasswordEnv)
+}
+
+// dirName is the directory the project is migrated to, its dir if set and otherwise its name
+func (p Project) dirName() string {
+	if p.Dir != "" {
+		return p.Dir
+	}
+	return p.Name
+}
+
+// trunkRef is the git-svn ref holding the project's main line, without the prefix
+// Standard projects have a trunk branch, otherwise a git-svn branch
+// git-svn always names the trunk ref "trunk", even when a custom trunk path is used
+func (p Project) trunkRef() string {
+	if p.customLayout() {
+		if p.Trunk != "" {
+			return "trunk"
+		}
+		return "git-svn"
+	}
+	if p.Standard {
+		return "trunk"
+	}
+	return "git-svn"
+}
+
+// customLayout is whether the project sets its own trunk, branches, or tags paths
+func (p Project) customLayout() bool {
+	return p.Trunk != "" || p.Branches != "" || p.Tags != ""
+}
+
+// Config describes where to migrate to and every project to migrate
+type Config struct {
+	BasePath            string              `toml:"base_path" yaml:"base_path"`
+	BasePaths           []string            `toml:"base_paths" yaml:"base_paths"`
+	BalanceBy           string              `toml:"balance_by" yaml:"balance_by"`
+	UsersPath           string              `toml:"users_path" yaml:"users_path"`
+	TagsScript          string              `toml:"tags_script" yaml:"tags_script"`
+	BranchesScript      string              `toml:"branches_script" yaml:"branches_script"`
+	PegsScript          string              `toml:"pegs_script" yaml:"pegs_script"`
+	BashPath            string              `toml:"bash_path" yaml:"bash_path"`
+	AuthorDomain        string              `toml:"author_domain" yaml:"author_domain"`
+	SVNBase             string              `toml:"svn_base" yaml:"svn_base"`
+	GitPath             string              `toml:"git_path" yaml:"git_path"`
+	LogDir              string              `toml:"log_dir" yaml:"log_dir"`
+	FileMode            string              `toml:"file_mode" yaml:"file_mode"`
+	LogRetain           int                 `toml:"log_retain" yaml:"log_retain"`
+	CompressLogs        bool                `toml:"compress_logs" yaml:"compress_logs"`
+	Shard               int                 `toml:"shard" yaml:"shard"`
+	MaxConcurrency      int                 `toml:"max_concurrency" yaml:"max_concurrency"`
+	LaunchStagger       Duration            `toml:"launch_stagger" yaml:"launch_stagger"`
+	LaunchJitter        Duration            `toml:"launch_jitter" yaml:"launch_jitter"`
+	ConcurrencySchedule []ConcurrencyWindow `toml:"concurrency_schedule" yaml:"concurrency_schedule"`
+	MaxDiskBytes        uint64              `toml:"max_disk_bytes" yaml:"max_disk_bytes"`
+	MaxRepoSize         int64               `toml:"max_repo_size" yaml:"max_repo_size"`
+	Timeout             Duration            `toml:"timeout" yaml:"timeout"`
+	MaxRetries          int                 `toml:"max_retries" yaml:"max_retries"`
+	ShallowRevisions    int                 `toml:"shallow_revisions" yaml:"shallow_revisions"`
+	ExtraArgs           []string            `toml:"extra_args" yaml:"extra_args"`
+	Prefix              string              `toml:"prefix" yaml:"prefix"`
+	Env                 map[string]string   `toml:"env" yaml:"env"`
+	KeepMetadata        bool                `toml:"keep_metadata" yaml:"keep_metadata"`
+	PruneBranches       bool                `toml:"prune_branches" yaml:"prune_branches"`
+	StrictCleanup       bool                `toml:"strict_cleanup" yaml:"strict_cleanup"`
+	DetectLayout        bool                `toml:"detect_layout" yaml:"detect_layout"`
+	PushRemote          string              `toml:"push_remote" yaml:"push_remote"`
+	WebhookURL          string              `toml:"webhook_url" yaml:"webhook_url"`
+	WebhookFailures     bool                `toml:"webhook_failures" yaml:"webhook_failures"`
+	GC                  bool                `toml:"gc" yaml:"gc"`
+	GCAggressive        bool                `toml:"gc_aggressive" yaml:"gc_aggressive"`
+	MigrationNote       bool                `toml:"migration_note" yaml:"migration_note"`
+	FetchExternals      bool                `toml:"fetch_externals" yaml:"fetch_externals"`
+	PreHook             []string            `toml:"pre_hook" yaml:"pre_hook"`
+	PostHook            []string            `toml:"post_hook" yaml:"post_hook"`
+	Bare                bool                `toml:"bare" yaml:"bare"`
+	Bundle              bool                `toml:"bundle" yaml:"bundle"`
+	BundleDir           string              `toml:"bundle_dir" yaml:"bundle_dir"`
+	Verify              bool                `toml:"verify" yaml:"verify"`
+	VerifyTolerance     int                 `toml:"verify_tolerance" yaml:"verify_tolerance"`
+	Projects            []Project           `toml:"projects" yaml:"projects"`
+}
+
+// DeriveURLs fills in the SVN url of every project without one from SVNBase and the project name
+func (c *Config) DeriveURLs() {
+	if c.SVNBase == "" {
+		return
+	}
+	base := strings.TrimRight(c.SVNBase, "/")
+	for idx := range c.Projects {
+		if c.Projects[idx].SVN == "" && c.Projects[idx].Dump == "" {
+			c.Projects[idx].SVN = base + "/" + c.Projects[idx].Name
+		}
+	}
+}
+
+// projectPath is where the repository and log of project go, relative to base_path and log_dir
+func (c Config) projectPath(p Project) string {
+	return c.shardedName(p.dirName())
+}
+
+// shardedName is the path of the directory name
+// With shard set, it goes under a directory named after the first shard characters of name, e.g. ab/abacus
+func (c Config) shardedName(name string) string {
+	if c.Shard <= 0 {
+		return name
+	}
+	if len(name) <= c.Shard {
+		return path.Join(name, name)
+	}
+	return path.Join(name[:c.Shard], name)
+}
+
+// Duration is a time.Duration that decodes from strings such as "2h"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// LoadConfig decodes configPath into config, as YAML or TOML depending on its extension
+// It returns the keys of a TOML config that don't match any option, so they can be warned about
+func LoadConfig(configPath string, config *Config) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(configPath)) {
+	case ".yaml", ".yml":
+		// Unknown keys are an error rather than a warning, yaml.v2 has no way to list them
+		data, err := ioutil.ReadFile(configPath)
+		if err != nil {
+			return nil, err
+		}
+		return nil, yaml.UnmarshalStrict(data, config)
+	default:
+		meta, err := toml.DecodeFile(configPath, config)
+		if err != nil {
+			return nil, err
+		}
+		var unknown []string
+		for _, key := range meta.Undecoded() {
+			unknown = append(unknown, key.String())
+		}
+		return unknown, nil
+	}
+}
+
+// WriteConfig encodes config to w as TOML, the way LoadConfig would read it back
+func WriteConfig(w io.Writer, config Config) error {
+	return toml.NewEncoder(w).Encode(config)
+}
+
+// ExpandEnv replaces ${VAR} and $VAR in the path and url fields of c and its projects with their environment values
+// Unset variables expand to empty, their names are returned so they can be warned about
+func (c *Config) ExpandEnv() []string {
+	var unset []string
+	seen := make(map[string]bool)
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			val, ok := os.LookupEnv(name)
+			if !ok && !seen[name] {
+				seen[name] = true
+				unset = append(unset, name)
+			}
+			return val
+		})
+	}
+
+	c.BasePath = expand(c.BasePath)
+	for idx := range c.BasePaths {
+		c.BasePaths[idx] = expand(c.BasePaths[idx])
+	}
+	c.UsersPath = expand(c.UsersPath)
+	c.SVNBase = expand(c.SVNBase)
+	c.LogDir = expand(c.LogDir)
+	for idx := range c.Projects {
+		p := &c.Projects[idx]
+		p.SVN = expand(p.SVN)
+		p.Username = expand(p.Username)
+	}
+	return unset
+}
+
+// ParseProjects reads one name=svnurl project per line, with an optional :std suffix for standard layouts
+// Blank lines and lines starting with # are ignored
+func ParseProjects(r io.Reader) ([]Project, error) {
+	var projects []Project
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var project Project
+		if strings.HasSuffix(text, ":std") {
+			project.Standard = true
+			text = strings.TrimSuffix(text, ":std")
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected name=svnurl, got %q", line, scanner.Text())
+		}
+		project.Name = strings.TrimSpace(parts[0])
+		project.SVN = strings.TrimSpace(parts[1])
+		projects = append(projects, project)
+	}
+	return projects, scanner.Err()
+}
+
+// Resolve is cfg the way a run sees it, with its paths made absolute and the defaults of unset options filled in
+// ExpandEnv and DeriveURLs are left to the caller, like for Run
+func Resolve(cfg Config) (Config, error) {
+	cfg, err := resolveConfig(cfg)
+	if err != nil {
+		return cfg, err
+	}
+	if cfg.MaxConcurrency <= 0 {
+		cfg.MaxConcurrency = runtime.NumCPU()
+	}
+	if cfg.GitPath == "" {
+		cfg.GitPath = "git"
+	}
+	if cfg.BashPath == "" {
+		cfg.BashPath = "bash"
+	}
+	if len(cfg.BasePaths) > 0 && cfg.BalanceBy == "" {
+		cfg.BalanceBy = balanceRoundRobin
+	}
+	return cfg, nil
+}
+
+// resolveConfig normalizes the svn urls of cfg and makes its paths absolute
+func resolveConfig(cfg Config) (Config, error) {
+	// Trailing slashes confuse git svn's idea of the repository layout
+	// The projects are copied first so the caller's config is left as it was
+	cfg.Projects = append([]Project(nil), cfg.Projects...)
+	for idx := range cfg.Projects {
+		cfg.Projects[idx].SVN, _ = normalizeURL(cfg.Projects[idx].SVN)
+		// From here on the prefix of a project is the one it is cloned with
+		if cfg.Projects[idx].Prefix == "" {
+			cfg.Projects[idx].Prefix = cfg.Prefix
+		}
+	}
+
+	// Everything else is joined to base_path, so it must not depend on the working directory
+	var err error
+	cfg.BasePath, err = filepath.Abs(cfg.BasePath)
+	if err != nil {
+		return cfg, fmt.Errorf("could not resolve base_path: %v", err)
+	}
+	cfg.BasePaths = append([]string(nil), cfg.BasePaths...)
+	for idx := range cfg.BasePaths {
+		cfg.BasePaths[idx], err = filepath.Abs(cfg.BasePaths[idx])
+		if err != nil {
+			return cfg, fmt.Errorf("could not resolve base path %s: %v", cfg.BasePaths[idx], err)
+		}
+	}
+	if cfg.UsersPath != "" && !filepath.IsAbs(cfg.UsersPath) {
+		cfg.UsersPath = filepath.Join(cfg.BasePath, cfg.UsersPath)
+	}
+	for _, script := range []*string{&cfg.TagsScript, &cfg.BranchesScript, &cfg.PegsScript} {
+		if *script != "" && !filepath.IsAbs(*script) {
+			*script = filepath.Join(cfg.BasePath, *script)
+		}
+	}
+	for idx := range cfg.Projects {
+		for _, file := range []*string{&cfg.Projects[idx].Dump, &cfg.Projects[idx].UsersPath} {
+			if *file != "" && !filepath.IsAbs(*file) {
+				*file = filepath.Join(cfg.BasePath, *file)
+			}
+		}
+	}
+	if cfg.BundleDir == "" {
+		cfg.BundleDir = path.Join(cfg.BasePath, "bundles")
+	} else if !filepath.IsAbs(cfg.BundleDir) {
+		cfg.BundleDir = filepath.Join(cfg.BasePath, cfg.BundleDir)
+	}
+	if cfg.LogDir == "" {
+		cfg.LogDir = path.Join(cfg.BasePath, "logs")
+	} else if !filepath.IsAbs(cfg.LogDir) {
+		cfg.LogDir = filepath.Join(cfg.BasePath, cfg.LogDir)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// dependency tracks whether a project that others depend on has finished, and whether it succeeded
+// ok is set before done is closed, so it is safe to read once done is
+type dependency struct {
+	done chan struct{}
+	ok   bool
+}
+
+// newDependencies makes a dependency for every project
+func newDependencies(projects []Project) map[string]*dependency {
+	deps := make(map[string]*dependency, len(projects))
+	for _, project := range projects {
+		deps[project.Name] = &dependency{done: make(chan struct{})}
+	}
+	return deps
+}
+
+// unknownDependencies returns a problem for every depends_on name that isn't one of projects, which is likely misspelled
+func unknownDependencies(projects []Project) []string {
+	known := make(map[string]bool, len(projects))
+	for _, project := range projects {
+		known[project.Name] = true
+	}
+	var problems []string
+	for _, project := range projects {
+		for _, dep := range project.DependsOn {
+			if !known[dep] {
+				problems = append(problems, fmt.Sprintf("project %s depends on unknown project %s", project.Name, dep))
+			}
+		}
+	}
+	return problems
+}
+
+// dependencyCycles returns every cycle of depends_on between projects, e.g. a -> b -> a
+// Names that aren't configured are left to unknownDependencies
+func dependencyCycles(projects []Project) []string {
+	byName := make(map[string]Project, len(projects))
+	for _, project := range projects {
+		byName[project.Name] = project
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(projects))
+	var (
+		cycles []string
+		stack  []string
+		visit  func(name string)
+	)
+	visit = func(name string) {
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range byName[name].DependsOn {
+			if _, ok := byName[dep]; !ok {
+				continue
+			}
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case visiting:
+				for idx := range stack {
+					if stack[idx] == dep {
+						cycles = append(cycles, strings.Join(append(stack[idx:], dep), " -> "))
+						break
+					}
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+	}
+	for _, project := range projects {
+		if state[project.Name] == unvisited {
+			visit(project.Name)
+		}
+	}
+	return cycles
+}
+
+// waitForDependencies blocks until every project that project depends on has finished
+// It returns an error if one of them failed, and returns early if ctx is done
+func (m *Migrator) waitForDependencies(ctx context.Context, project Project) error {
+	for _, name := range project.DependsOn {
+		dep, ok := m.dependencies[name]
+		if !ok {
+			continue
+		}
+		select {
+		case <-dep.done:
+		case <-ctx.Done():
+			return nil
+		}
+		if !dep.ok {
+			return fmt.Errorf("dependency %s failed", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package migrate
+
+import (
+	"context"
+	"time"
+)
+
+// diskPoll is how often waitForDisk checks whether enough space has been freed
+const diskPoll = 30 * time.Second
+
+// waitForDisk holds project back until its base path has at least max_disk_bytes available, or ctx is done
+// Running projects are left alone, so space freed by their gc lets waiting projects start
+func (m *Migrator) waitForDisk(ctx context.Context, project Project) {
+	if m.config.MaxDiskBytes == 0 || m.DryRun {
+		return
+	}
+	for waiting := false; ; waiting = true {
+		free, err := freeBytes(m.baseOf(project))
+		if err != nil {
+			m.Logger.Errorf("Could not check the free disk space for %s, starting anyway: %v", project.Name, err)
+			return
+		}
+		if free >= m.config.MaxDiskBytes {
+			if waiting {
+				m.Logger.Infof("%d bytes are free again, starting %s", free, project.Name)
+			}
+			return
+		}
+		if !waiting {
+			m.Logger.Printf("Waiting to start %s, only %d bytes are free of the %d max_disk_bytes", project.Name, free, m.config.MaxDiskBytes)
+			m.events.Printf("%s: waiting for disk space, %d bytes free", project.Name, free)
+		}
+		select {
+		case <-time.After(diskPoll):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
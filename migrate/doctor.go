@@ -0,0 +1,100 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Check is one item of the checklist Doctor returns, Err is nil if it passed
+type Check struct {
+	Name string
+	Err  error
+}
+
+// Doctor checks everything a run of cfg depends on, without writing anything or running git svn
+// Every check is run even if earlier ones fail, so all problems are found at once
+func (m *Migrator) Doctor(ctx context.Context, cfg Config) []Check {
+	checks := []Check{{Name: "config is valid", Err: Validate(cfg)}}
+
+	cfg, err := resolveConfig(cfg)
+	if err != nil {
+		return append(checks, Check{Name: "base_path is writable", Err: err})
+	}
+	m.config = cfg
+	ctx = withSVNConfigDir(ctx, m.SVNConfigDir)
+
+	checks = append(checks,
+		Check{Name: "git is installed", Err: exec.CommandContext(ctx, m.gitPath(), "--version").Run()},
+		Check{Name: "git-svn is installed", Err: exec.CommandContext(ctx, m.gitPath(), "svn", "--version").Run()},
+		Check{Name: "svn is installed", Err: exec.CommandContext(ctx, "svn", "--version", "--quiet").Run()},
+	)
+	if cfg.hasDumps() {
+		checks = append(checks, Check{Name: "svnadmin is installed", Err: exec.CommandContext(ctx, "svnadmin", "--version", "--quiet").Run()})
+	}
+	if len(cfg.cleanupScripts()) > 0 {
+		checks = append(checks, Check{
+			Name: fmt.Sprintf("bash is installed at %s", m.bashPath()),
+			Err:  exec.CommandContext(ctx, m.bashPath(), "--version").Run(),
+		})
+	}
+	checks = append(checks, Check{Name: fmt.Sprintf("base_path %s is writable", cfg.BasePath), Err: writable(cfg.BasePath)})
+	for _, base := range cfg.BasePaths {
+		checks = append(checks, Check{Name: fmt.Sprintf("base path %s is writable", base), Err: writable(base)})
+	}
+	if cfg.UsersPath != "" {
+		checks = append(checks, Check{Name: fmt.Sprintf("users_path %s is readable", cfg.UsersPath), Err: readable(cfg.UsersPath)})
+	}
+
+	for _, project := range cfg.Projects {
+		if project.UsersPath != "" {
+			checks = append(checks, Check{Name: fmt.Sprintf("users_path %s of %s is readable", project.UsersPath, project.Name), Err: readable(project.UsersPath)})
+		}
+		if project.Dump != "" {
+			checks = append(checks, Check{Name: fmt.Sprintf("%s has a readable dump at %s", project.Name, project.Dump), Err: readable(project.Dump)})
+			continue
+		}
+		ctx := withEnv(ctx, envList(m.projectEnv(project)))
+		checks = append(checks, Check{
+			Name: fmt.Sprintf("%s is reachable at %s", project.Name, project.SVN),
+			Err:  svnInfo(ctx, project),
+		})
+	}
+	return checks
+}
+
+// writable is whether a file can be created in dir, or in the closest parent that exists if dir does not
+func writable(dir string) error {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return fmt.Errorf("no parent of %s exists", dir)
+		}
+		dir = parent
+	}
+	tmp, err := ioutil.TempFile(dir, ".doctor")
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Remove(tmp.Name())
+}
+
+// readable is whether file can be opened for reading
+func readable(file string) error {
+	fi, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	return fi.Close()
+}
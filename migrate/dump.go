@@ -0,0 +1,91 @@
+package migrate
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hasDumps is whether any project is migrated from a dump file
+func (c Config) hasDumps() bool {
+	for _, project := range c.Projects {
+		if project.Dump != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// loadDump loads the dump file of project into a new repository in a temporary directory
+// It returns the file url of the repository and the directory to remove once the project is done
+func (m *Migrator) loadDump(ctx context.Context, project Project, out io.Writer) (url, tmp string, err error) {
+	tmp, err = ioutil.TempDir("", "go-migrate-"+project.dirName()+"-")
+	if err != nil {
+		return "", "", err
+	}
+	repo := filepath.Join(tmp, "repo")
+
+	if err := m.run(command(ctx, "", "svnadmin", "create", repo), out); err != nil {
+		return "", tmp, err
+	}
+
+	dump, err := os.Open(project.Dump)
+	if err != nil {
+		return "", tmp, err
+	}
+	defer dump.Close()
+	load := command(ctx, "", "svnadmin", "load", "--quiet", repo)
+	load.Stdin = dump
+	if err := m.run(load, out); err != nil {
+		return "", tmp, err
+	}
+	return fileURL(repo), tmp, nil
+}
+
+// fileURL is the file:// url of the local path, which is absolute
+// Windows paths such as C:\repo get the extra slash of file:///C:/repo
+func fileURL(path string) string {
+	slashed := filepath.ToSlash(path)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed
+	}
+	return "file://" + slashed
+}
+
+// dumpAuthors returns the unique svn:author revision properties in the dump file
+// The dump is read line by line rather than parsed, contents that happen to look like the property only add a user
+func dumpAuthors(file string) ([]string, error) {
+	fi, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close()
+
+	// Properties look like "K 10\nsvn:author\nV 4\njdoe\n"
+	seen := make(map[string]bool)
+	var authors []string
+	var prev []string
+	r := bufio.NewReader(fi)
+	for {
+		line, err := r.ReadString('\n')
+		line = strings.TrimSuffix(line, "\n")
+		if len(prev) == 3 && prev[0] == "K 10" && prev[1] == "svn:author" && strings.HasPrefix(prev[2], "V ") && !seen[line] {
+			seen[line] = true
+			authors = append(authors, line)
+		}
+		prev = append(prev, line)
+		if len(prev) > 3 {
+			prev = prev[1:]
+		}
+		if err == io.EOF {
+			return authors, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+type (
+	envKey       struct{}
+	svnConfigKey struct{}
+)
+
+// withEnv makes every command built by command with ctx run with env on top of our own environment
+// The environment travels with the context because every command of a project is already built from it
+func withEnv(ctx context.Context, env []string) context.Context {
+	if len(env) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, envKey{}, env)
+}
+
+// command builds a command that runs in dir, with the environment of ctx
+func command(ctx context.Context, dir, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = dir
+	if env, ok := ctx.Value(envKey{}).([]string); ok {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	recordCommand(ctx, cmd)
+	return cmd
+}
+
+// withSVNConfigDir makes every command built by svnCommand with ctx read its config and cached credentials from dir
+// An empty dir leaves svn to its default of ~/.subversion, or %APPDATA%\\Subversion on Windows
+func withSVNConfigDir(ctx context.Context, dir string) context.Context {
+	if dir == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, svnConfigKey{}, dir)
+}
+
+// svnCommand builds an svn command with the environment and config directory of ctx
+// args starts with the subcommand, which --config-dir is put after
+func svnCommand(ctx context.Context, args ...string) *exec.Cmd {
+	if dir, ok := ctx.Value(svnConfigKey{}).(string); ok && len(args) > 0 {
+		args = append([]string{args[0], "--config-dir", dir}, args[1:]...)
+	}
+	return command(ctx, "", "svn", args...)
+}
+
+// projectSVN builds an svn command for the url of project, which is put after args, with the credentials of project
+// args starts with the subcommand; the password of password_env goes to svn on stdin, like it does to git svn,
+// which needs svn 1.10 or later for --password-from-stdin
+func projectSVN(ctx context.Context, project Project, args ...string) *exec.Cmd {
+	args = append(args, "--non-interactive")
+	if project.Username != "" {
+		args = append(args, "--username", project.Username)
+	}
+	password := project.password()
+	if password != "" {
+		args = append(args, "--password-from-stdin")
+	}
+	cmd := svnCommand(ctx, append(args, project.SVN)...)
+	if password != "" {
+		cmd.Stdin = strings.NewReader(password + "\n")
+	}
+	return cmd
+}
+
+// projectEnv is the env of the config merged with that of project, which wins for keys set in both
+func (m *Migrator) projectEnv(project Project) map[string]string {
+	env := make(map[string]string, len(m.config.Env)+len(project.Env))
+	for key, val := range m.config.Env {
+		env[key] = val
+	}
+	for key, val := range project.Env {
+		env[key] = val
+	}
+	return env
+}
+
+// envList turns env into KEY=value pairs, sorted so commands are logged the same way every time
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for key, val := range env {
+		list = append(list, key+"="+val)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// envSecrets picks the values of env that must not show up in logs
+// These are the values of keys that look like credentials, and passwords in urls such as proxy settings
+func envSecrets(env map[string]string) []string {
+	var secrets []string
+	for key, val := range env {
+		if val == "" {
+			continue
+		}
+		upper := strings.ToUpper(key)
+		for _, hint := range []string{"PASS", "TOKEN", "SECRET", "KEY", "AUTH"} {
+			if strings.Contains(upper, hint) {
+				secrets = append(secrets, val)
+				break
+			}
+		}
+		if u, err := url.Parse(val); err == nil && u.User != nil {
+			if password, ok := u.User.Password(); ok && password != "" {
+				secrets = append(secrets, password)
+			}
+		}
+	}
+	return secrets
+}
+
+// Redact wraps w to hide the secrets in the env of config and its projects, the same way the logs do
+func Redact(w io.Writer, config Config) io.Writer {
+	secrets := envSecrets(config.Env)
+	for _, project := range config.Projects {
+		secrets = append(secrets, envSecrets(project.Env)...)
+	}
+	if len(secrets) == 0 {
+		return w
+	}
+	return &redactor{w: w, secrets: secrets}
+}
@@ -0,0 +1,64 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+)
+
+// The stages of migrating a project, as recorded by a StageError
+const (
+	// StageSchedule is waiting for dependencies and a free slot
+	StageSchedule = "schedule"
+	// StagePrepare is checking or removing an existing directory and opening the log
+	StagePrepare = "prepare"
+	// StagePreHook is running the pre_hook
+	StagePreHook = "pre_hook"
+	// StageClone is git svn clone, or git svn fetch with -update
+	StageClone = "clone"
+	// StageCleanup is converting refs, looking for svn:externals, and gc
+	StageCleanup = "cleanup"
+	// StageVerify is comparing SVN revisions to git commits
+	StageVerify = "verify"
+	// StageHook is running the post_hook
+	StageHook = "post_hook"
+	// StageBare is making the bare <name>.git
+	StageBare = "bare"
+	// StagePush is mirroring to the push_remote
+	StagePush = "push"
+	// StageBundle is writing the <name>.bundle
+	StageBundle = "bundle"
+)
+
+// cleanupError combines the errors of the cleanup steps that failed into one
+func cleanupError(errs []error) error {
+	msgs := make([]string, len(errs))
+	for idx, err := range errs {
+		msgs[idx] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// StageError is why a project failed, along with the stage it failed in
+type StageError struct {
+	Stage string
+	// Reason is the likely cause recognized in the log, e.g. svn authentication failed, or empty if there was none
+	Reason string
+	Err    error
+}
+
+func (e *StageError) Error() string {
+	if e.Reason != "" {
+		return e.Stage + ": " + e.Reason + ": " + e.Err.Error()
+	}
+	return e.Stage + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error, such as the *exec.ExitError of a failed command
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// stageError wraps err in a StageError for stage
+func stageError(stage string, err error) error {
+	return &StageError{Stage: stage, Err: err}
+}
@@ -0,0 +1,49 @@
+package migrate
+
+import "time"
+
+// Event is a machine readable record of a project starting or finishing, as passed to Migrator.OnEvent
+// Finish events carry the progress of the run as of that project, like Logger.Progress
+type Event struct {
+	Event      string    `json:"event"`
+	Project    string    `json:"project,omitempty"`
+	Time       time.Time `json:"time"`
+	Status     string    `json:"status,omitempty"`
+	DurationMS int64     `json:"duration_ms,omitempty"`
+	Stage      string    `json:"stage,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Cleanup    []string  `json:"cleanup_errors,omitempty"`
+	Complete   int       `json:"complete,omitempty"`
+	Total      int       `json:"total,omitempty"`
+	Failed     int       `json:"failed,omitempty"`
+	Empty      int       `json:"empty,omitempty"`
+}
+
+// emit passes e to OnEvent, if it is set
+func (m *Migrator) emit(e Event) {
+	if m.OnEvent == nil {
+		return
+	}
+	e.Time = time.Now()
+	m.OnEvent(e)
+}
+
+// finishEvent is the Event of result finishing as number complete of total
+func finishEvent(result Result, complete, total int) Event {
+	e := Event{
+		Event:      "finish",
+		Project:    result.Project.Name,
+		Status:     result.Status(),
+		DurationMS: int64(result.Duration() / time.Millisecond),
+		Complete:   complete,
+		Total:      total,
+	}
+	for _, err := range result.CleanupErrors {
+		e.Cleanup = append(e.Cleanup, err.Error())
+	}
+	if result.Err != nil {
+		e.Stage = result.Stage()
+		e.Error = result.Err.Error()
+	}
+	return e
+}
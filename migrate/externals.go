@@ -0,0 +1,125 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// external is one svn:externals definition, checked out at Dir below the directory that has the property
+type external struct {
+	Owner string
+	Dir   string
+	URL   string
+}
+
+// externals lists the svn:externals set anywhere in project, which git svn clone leaves out
+func externals(ctx context.Context, project Project, out io.Writer) ([]external, error) {
+	cmd := projectSVN(ctx, project, "propget", "-R", "svn:externals")
+	cmd.Stderr = out
+	_, _ = fmt.Fprintf(out, "%s\n", strings.Join(cmd.Args, " "))
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	exts, unparsed := parseExternals(stdout)
+	for _, line := range unparsed {
+		_, _ = fmt.Fprintf(out, "Warning: could not understand the svn:externals definition %q\n", line)
+	}
+	return exts, nil
+}
+
+// parseExternals reads the output of svn propget -R svn:externals
+// Each property starts with "<owner url> - " followed by its first definition, any more follow on their own lines
+// Definitions are either "url dir" or the pre-1.5 "dir url", both optionally with a revision as -rN or -r N,
+// and urls can have a peg revision as url@N, which is dropped
+// Lines that are none of these are returned as unparsed, so they can be warned about
+func parseExternals(output []byte) (exts []external, unparsed []string) {
+	var owner string
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if idx := strings.Index(line, " - "); idx > 0 && !strings.HasPrefix(line, " ") {
+			owner, line = line[:idx], line[idx+3:]
+		}
+
+		var fields []string
+		tokens := strings.Fields(line)
+		for idx := 0; idx < len(tokens); idx++ {
+			switch {
+			case tokens[idx] == "-r":
+				// The revision is the token after a bare -r
+				idx++
+			case strings.HasPrefix(tokens[idx], "-r"):
+			default:
+				fields = append(fields, tokens[idx])
+			}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			unparsed = append(unparsed, strings.TrimSpace(line))
+			continue
+		}
+
+		ext := external{Owner: owner, URL: fields[0], Dir: fields[1]}
+		if isExternalURL(fields[1]) && !isExternalURL(fields[0]) {
+			ext.URL, ext.Dir = fields[1], fields[0]
+		}
+		ext.URL = withoutPeg(ext.URL)
+		exts = append(exts, ext)
+	}
+	return exts, unparsed
+}
+
+// withoutPeg drops the peg revision of url, e.g. the @148 of http://svn/lib@148
+func withoutPeg(url string) string {
+	idx := strings.LastIndex(url, "@")
+	if idx < 0 {
+		return url
+	}
+	if peg := url[idx+1:]; peg == "HEAD" || (peg != "" && strings.Trim(peg, "0123456789") == "") {
+		return url[:idx]
+	}
+	return url
+}
+
+// isExternalURL is whether s looks like the url half of an svn:externals definition, absolute or relative
+func isExternalURL(s string) bool {
+	return strings.Contains(s, "://") || strings.HasPrefix(s, "^/") || strings.HasPrefix(s, "//") ||
+		strings.HasPrefix(s, "../") || strings.HasPrefix(s, "/")
+}
+
+// fetchExternals clones every external with an absolute url as its own sibling of project, named project-dir
+// Externals with relative urls are only logged, they would need resolving against the repository root
+// Siblings that already exist are left alone
+func (m *Migrator) fetchExternals(ctx context.Context, project Project, exts []external, out io.Writer) error {
+	var lastErr error
+	for _, ext := range exts {
+		if !strings.Contains(ext.URL, "://") {
+			_, _ = fmt.Fprintf(out, "Not fetching external %s, its url %s is relative\n", ext.Dir, ext.URL)
+			continue
+		}
+
+		sibling := Project{
+			Name:        project.Name + "-" + strings.Replace(strings.Trim(ext.Dir, "/"), "/", "-", -1),
+			SVN:         ext.URL,
+			Username:    project.Username,
+			PasswordEnv: project.PasswordEnv,
+		}
+		if m.config.existingBase(sibling) != "" {
+			_, _ = fmt.Fprintf(out, "Not fetching external %s, %s already exists\n", ext.Dir, sibling.Name)
+			continue
+		}
+
+		m.Logger.Infof("Fetching external %s of %s...", ext.Dir, project.Name)
+		if err := m.clone(ctx, sibling, out); err != nil {
+			lastErr = fmt.Errorf("%s: %v", ext.URL, err)
+		}
+	}
+	return lastErr
+}
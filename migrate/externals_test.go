@@ -0,0 +1,37 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExternals(t *testing.T) {
+	output := `https://svn/app/trunk - https://svn/lib/trunk lib
+-r148 https://svn/old/trunk old
+-r 148 https://svn/pinned/trunk pinned
+https://svn/peg/trunk@150 peg
+vendor/legacy -r 12 https://svn/legacy/trunk
+^/shared/trunk shared
+
+https://svn/app/trunk/docs - https://svn/theme@HEAD theme
+what is this
+`
+	wantExts := []external{
+		{Owner: "https://svn/app/trunk", URL: "https://svn/lib/trunk", Dir: "lib"},
+		{Owner: "https://svn/app/trunk", URL: "https://svn/old/trunk", Dir: "old"},
+		{Owner: "https://svn/app/trunk", URL: "https://svn/pinned/trunk", Dir: "pinned"},
+		{Owner: "https://svn/app/trunk", URL: "https://svn/peg/trunk", Dir: "peg"},
+		{Owner: "https://svn/app/trunk", URL: "https://svn/legacy/trunk", Dir: "vendor/legacy"},
+		{Owner: "https://svn/app/trunk", URL: "^/shared/trunk", Dir: "shared"},
+		{Owner: "https://svn/app/trunk/docs", URL: "https://svn/theme", Dir: "theme"},
+	}
+	wantUnparsed := []string{"what is this"}
+
+	exts, unparsed := parseExternals([]byte(output))
+	if !reflect.DeepEqual(exts, wantExts) {
+		t.Errorf("parseExternals() externals = %+v, want %+v", exts, wantExts)
+	}
+	if !reflect.DeepEqual(unparsed, wantUnparsed) {
+		t.Errorf("parseExternals() unparsed = %q, want %q", unparsed, wantUnparsed)
+	}
+}
@@ -0,0 +1,48 @@
+package migrate
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// svnHost is the hostname a project's SVN url points at, in lower case
+// file:// urls all share the empty host
+func svnHost(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// newHostLimits makes a semaphore of size limit for every SVN host in projects
+// A limit of zero or less means hosts are unlimited and no semaphores are made
+func newHostLimits(projects []Project, limit int) map[string]chan struct{} {
+	if limit <= 0 {
+		return nil
+	}
+	hosts := make(map[string]chan struct{})
+	for _, project := range projects {
+		host := svnHost(project.SVN)
+		if _, ok := hosts[host]; !ok {
+			hosts[host] = make(chan struct{}, limit)
+		}
+	}
+	return hosts
+}
+
+// acquireHost takes a slot on the SVN host of project, returning the func to give it back
+// It returns early when ctx is done, in which case there is nothing to give back
+func (m *Migrator) acquireHost(ctx context.Context, project Project) func() {
+	sem, ok := m.hosts[svnHost(project.SVN)]
+	if !ok {
+		return func() {}
+	}
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }
+	case <-ctx.Done():
+		return func() {}
+	}
+}
@@ -0,0 +1,31 @@
+package migrate
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// Logger receives the console output of a migration from every project at once, so it must be safe for concurrent use
+// Errorf and Printf are always meant to be shown, Infof reports each step as it starts, and Debugf every command
+type Logger interface {
+	Errorf(format string, args ...interface{})
+	Printf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Debugf(format string, args ...interface{})
+	// Verbose is whether command output should also be echoed to Writer
+	Verbose() bool
+	Writer() io.Writer
+	// Progress is called with the number of finished projects every time one finishes
+	Progress(complete, total int)
+}
+
+// nopLogger discards everything, it is used when a Migrator has no Logger
+type nopLogger struct{}
+
+func (nopLogger) Errorf(string, ...interface{}) {}
+func (nopLogger) Printf(string, ...interface{}) {}
+func (nopLogger) Infof(string, ...interface{})  {}
+func (nopLogger) Debugf(string, ...interface{}) {}
+func (nopLogger) Verbose() bool                 { return false }
+func (nopLogger) Writer() io.Writer             { return ioutil.Discard }
+func (nopLogger) Progress(int, int)             {}
@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// manifest records which projects finished migrating, so an interrupted run can be resumed
+// It is saved after every project, so a crash loses at most the projects that were running
+// Shallow has the projects only cloned from a recent revision, with that revision, until they are deepened
+type manifest struct {
+	mu   sync.Mutex
+	path string
+	// config is where the file_mode of the saved manifest comes from
+	config  Config
+	Done    map[string]time.Time `json:"done"`
+	Shallow map[string]int       `json:"shallow,omitempty"`
+}
+
+// loadManifest reads the manifest at path, a missing manifest is an empty one
+func loadManifest(path string, config Config) (*manifest, error) {
+	m := &manifest{path: path, config: config, Done: make(map[string]time.Time), Shallow: make(map[string]int)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Done == nil {
+		m.Done = make(map[string]time.Time)
+	}
+	if m.Shallow == nil {
+		m.Shallow = make(map[string]int)
+	}
+	return m, nil
+}
+
+// done is whether name finished migrating in an earlier run
+func (m *manifest) done(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.Done[name]
+	return ok
+}
+
+// shallowFrom is the revision a shallow clone of name starts at, or 0 if it isn't shallow
+func (m *manifest) shallowFrom(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Shallow[name]
+}
+
+// markDone records that name finished migrating with its full history and saves the manifest
+func (m *manifest) markDone(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.Shallow, name)
+	m.Done[name] = time.Now()
+	return m.save()
+}
+
+// markShallow records that name was only cloned from revision from onwards and saves the manifest
+func (m *manifest) markShallow(name string, from int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Shallow[name] = from
+	return m.save()
+}
+
+// save writes the manifest to a temporary file first, so a crash mid-write leaves the previous manifest intact
+// It must be called with mu held
+func (m *manifest) save() error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp := m.path + ".tmp"
+	if err := m.config.writeFile(tmp, data, m.config.fileMode(0644)); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.path)
+}
@@ -0,0 +1,1359 @@
+package migrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Migrator converts the projects of a Config from SVN to git
+// Its options are set before calling Run, and it runs one migration at a time
+// Separate Migrators share nothing, so several can run in the same process
+type Migrator struct {
+	DryRun     bool
+	Update     bool
+	Force      bool
+	FailFast   bool
+	AssetsOnly bool
+	// Reset forgets which projects earlier runs finished, see manifest
+	Reset bool
+	// Deepen clones the full history of projects an earlier run only cloned shallow_revisions of
+	Deepen      bool
+	CleanAssets bool
+	// Ordered holds back the finished message of every project until all are done, then prints them and
+	// returns the results in the order of the config rather than the order they finished in
+	Ordered bool
+	// Since skips updating projects whose SVN url has not changed since then
+	Since time.Time
+	// ConcurrencyPerHost limits how many projects clone from the same SVN host at once, zero is unlimited
+	ConcurrencyPerHost int
+	// SVNConfigDir replaces ~/.subversion for svn and git svn, so the credentials cached there are used
+	SVNConfigDir string
+	// OnEvent is called with an Event as each project starts and finishes, from every project at once,
+	// so it must be safe for concurrent use
+	OnEvent func(Event)
+	// Script receives every command of every project as a shell script, one block per project as it finishes
+	Script io.Writer
+	// Tail names a project whose git output is also written to the Logger
+	Tail   string
+	Logger Logger
+
+	config       Config
+	queue        queue
+	slots        *slots
+	hosts        map[string]chan struct{}
+	push         *template.Template
+	events       *log.Logger
+	stopAll      context.CancelFunc
+	dependencies map[string]*dependency
+	authorsFile  string
+	// projectAuthors are the authors files of projects with their own users_path, by name
+	projectAuthors map[string]string
+	scripts        map[string]string
+	manifest       *manifest
+	partial        map[string]string
+	scriptMu       sync.Mutex
+	// bases are the base paths assigned to projects when there are base_paths, by name
+	bases    map[string]string
+	nextBase int
+	baseMu   sync.Mutex
+	// noSVN is set by preflight when svn isn't installed, which skips checking svn:externals
+	noSVN bool
+}
+
+// Run migrates every project in cfg, as many at once as max_concurrency allows, and returns once all are finished
+// The returned error is only for problems that stop the run from starting, each project's own error is in its Result
+// Cancelling ctx stops every migration, projects that had yet to start are skipped
+func (m *Migrator) Run(ctx context.Context, cfg Config) (Results, error) {
+	if m.Logger == nil {
+		m.Logger = nopLogger{}
+	}
+	m.queue.reset()
+
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+	cfg, err := resolveConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.config = cfg
+
+	if err := os.MkdirAll(cfg.BasePath, 0755); err != nil {
+		return nil, fmt.Errorf("could not create base_path: %v", err)
+	}
+	for _, base := range cfg.BasePaths {
+		if err := os.MkdirAll(base, 0755); err != nil {
+			return nil, fmt.Errorf("could not create base path %s: %v", base, err)
+		}
+	}
+	m.bases, m.nextBase = nil, 0
+	m.noSVN = false
+
+	if !m.DryRun {
+		if err := m.preflight(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.checkAssets(); err != nil {
+		return nil, fmt.Errorf("could not generate assets: %v", err)
+	}
+	if m.AssetsOnly {
+		m.Logger.Printf("Wrote %s", m.authorsFile)
+		for _, file := range m.projectAuthors {
+			m.Logger.Printf("Wrote %s", file)
+		}
+		return nil, nil
+	}
+
+	eventLog, err := cfg.openFile(path.Join(cfg.BasePath, "migration.log"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, cfg.fileMode(0644))
+	if err != nil {
+		return nil, fmt.Errorf("could not open migration log: %v", err)
+	}
+	defer eventLog.Close()
+	m.events = log.New(eventLog, "", log.LstdFlags)
+
+	manifestPath := path.Join(cfg.BasePath, "manifest.json")
+	if m.Reset && !m.DryRun {
+		if err := os.Remove(manifestPath); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("could not reset the manifest: %v", err)
+		}
+	}
+	m.manifest, err = loadManifest(manifestPath, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the manifest: %v", err)
+	}
+
+	m.push = nil
+	if cfg.PushRemote != "" {
+		m.push, err = template.New("push_remote").Parse(cfg.PushRemote)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse push_remote: %v", err)
+		}
+	}
+
+	limit := cfg.MaxConcurrency
+	if limit <= 0 {
+		limit = runtime.NumCPU()
+	}
+	m.slots = newSlots(func(now time.Time) int { return cfg.concurrency(now, limit) })
+	m.hosts = newHostLimits(cfg.Projects, m.ConcurrencyPerHost)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	m.stopAll = cancel
+	ctx = withSVNConfigDir(ctx, m.SVNConfigDir)
+
+	start := time.Now()
+	m.Logger.Progress(0, len(cfg.Projects))
+	m.dependencies = newDependencies(cfg.Projects)
+	m.partial = m.findPartialClones(cfg.Projects)
+	for idx, project := range cfg.Projects {
+		if idx > 0 {
+			m.stagger(ctx)
+		}
+		m.queue.Add(1)
+		go m.migrate(ctx, project)
+	}
+	m.queue.wg.Wait()
+
+	if m.CleanAssets {
+		if err := m.cleanAssets(); err != nil {
+			m.Logger.Errorf("Could not clean assets: %v", err)
+		}
+	}
+
+	m.queue.mu.Lock()
+	results := append(Results(nil), m.queue.Results...)
+	m.queue.mu.Unlock()
+
+	// Finished projects were held back, so they are printed in the order of the config no matter how the run went
+	if m.Ordered {
+		order := make(map[string]int, len(cfg.Projects))
+		for idx, project := range cfg.Projects {
+			order[project.Name] = idx
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return order[results[i].Project.Name] < order[results[j].Project.Name]
+		})
+		for idx, result := range results {
+			m.printFinished(idx+1, len(results), result)
+		}
+	}
+
+	m.notify("the migration finished", newFinishedEvent(results, time.Since(start)))
+	return results, nil
+}
+
+// Result is the outcome of migrating a single project
+type Result struct {
+	Project      Project
+	Start        time.Time
+	End          time.Time
+	Skipped      bool
+	Empty        bool
+	Pushed       string
+	SVNRevisions int
+	// FirstRevision and LastRevision are the range of SVN revisions in the git repository
+	FirstRevision int
+	LastRevision  int
+	ShallowFrom   int
+	GitCommits    int
+	// CleanupErrors are the cleanup steps that failed, without strict_cleanup the project still migrates
+	CleanupErrors []error
+	// BasePath is which of the base_paths the project was cloned into, it is only set when there are base_paths
+	BasePath string
+	// Bundle is the <name>.bundle written with bundle = true, and BundleSHA256 its checksum
+	Bundle       string
+	BundleSHA256 string
+	Err          error
+}
+
+// Duration is how long the project took, or zero if it never started
+func (r Result) Duration() time.Duration {
+	if r.Start.IsZero() {
+		return 0
+	}
+	return r.End.Sub(r.Start)
+}
+
+// Stage is the stage the project failed in, or empty if it didn't fail
+func (r Result) Stage() string {
+	if err, ok := r.Err.(*StageError); ok {
+		return err.Stage
+	}
+	return ""
+}
+
+// Reason is the likely cause of the failure recognized in the log of the project, or empty if there was none
+func (r Result) Reason() string {
+	if err, ok := r.Err.(*StageError); ok {
+		return err.Reason
+	}
+	return ""
+}
+
+// Status summarizes the result as migrated, partial, skipped, empty, or failed
+// Partial projects were cloned, but at least one cleanup step failed
+func (r Result) Status() string {
+	switch {
+	case r.Err != nil:
+		return "failed"
+	case len(r.CleanupErrors) > 0:
+		return "partial"
+	case r.Empty:
+		return "empty"
+	case r.Skipped:
+		return "skipped"
+	}
+	return "migrated"
+}
+
+// queue tracks the projects of a run as they start and finish
+type queue struct {
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	Complete int
+	Total    int
+	Results  []Result
+	Running  map[string]time.Time
+}
+
+// reset forgets the previous run
+func (q *queue) reset() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.Complete, q.Total = 0, 0
+	q.Results, q.Running = nil, nil
+}
+
+func (q *queue) Add(delta int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.wg.Add(delta)
+	q.Total += delta
+}
+
+// Start marks a project as running
+func (q *queue) Start(name string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.Running == nil {
+		q.Running = make(map[string]time.Time)
+	}
+	q.Running[name] = time.Now()
+}
+
+// Done records the result of one project and returns the progress as of that project
+func (q *queue) Done(result Result) (complete, total int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.Running, result.Project.Name)
+	q.Complete++
+	q.Results = append(q.Results, result)
+	q.wg.Done()
+	return q.Complete, q.Total
+}
+
+// Results are the outcomes of every project in a run, in the order they finished
+type Results []Result
+
+// Empty returns the results of every project that migrated without any commits
+func (r Results) Empty() Results {
+	var empty Results
+	for _, result := range r {
+		if result.Empty && result.Err == nil {
+			empty = append(empty, result)
+		}
+	}
+	return empty
+}
+
+// Partial returns the results of every project that migrated with cleanup errors
+func (r Results) Partial() Results {
+	var partial Results
+	for _, result := range r {
+		if result.Status() == "partial" {
+			partial = append(partial, result)
+		}
+	}
+	return partial
+}
+
+// Failed returns the results of every project that did not migrate
+func (r Results) Failed() Results {
+	var failed Results
+	for _, result := range r {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// printFinished prints that the project of result finished, as number complete of total
+func (m *Migrator) printFinished(complete, total int, result Result) {
+	elapsed := result.Duration().Round(time.Second)
+	if result.Empty && result.Err == nil {
+		m.Logger.Printf("[%d/%d] Migrated %s in %s, but it is empty", complete, total, result.Project.Name, elapsed)
+	} else if result.Status() == "partial" {
+		m.Logger.Printf("[%d/%d] Migrated %s in %s, but %d cleanup steps failed", complete, total, result.Project.Name, elapsed, len(result.CleanupErrors))
+	} else {
+		m.Logger.Printf("[%d/%d] Finished migrating %s in %s", complete, total, result.Project.Name, elapsed)
+	}
+}
+
+func (m *Migrator) migrate(ctx context.Context, project Project) {
+	result := Result{Project: project}
+	defer func() {
+		result.End = time.Now()
+		switch {
+		case result.Err != nil:
+			m.events.Printf("%s: failed: %v", project.Name, result.Err)
+			if m.FailFast {
+				m.stopAll()
+			}
+			if m.config.WebhookFailures {
+				m.notify(project.Name+" failed", failedEvent{Event: "failed", Project: project.Name, Error: result.Err.Error()})
+			}
+		case result.Empty:
+			m.events.Printf("%s: empty, the clone has no commits", project.Name)
+		case len(result.CleanupErrors) > 0:
+			m.events.Printf("%s: finished in %s with %d cleanup errors", project.Name, result.Duration(), len(result.CleanupErrors))
+		case !result.Skipped:
+			m.events.Printf("%s: finished in %s", project.Name, result.Duration())
+		}
+		if status := result.Status(); (status == "migrated" || status == "partial") && !m.DryRun {
+			record := m.manifest.markDone
+			if result.ShallowFrom > 0 {
+				record = func(name string) error { return m.manifest.markShallow(name, result.ShallowFrom) }
+			}
+			if err := record(project.Name); err != nil {
+				m.Logger.Errorf("Could not record %s in the manifest: %v", project.Name, err)
+			}
+		}
+		if dep, ok := m.dependencies[project.Name]; ok {
+			dep.ok = result.Err == nil
+			close(dep.done)
+		}
+		complete, total := m.queue.Done(result)
+		m.emit(finishEvent(result, complete, total))
+		if !m.Ordered {
+			m.printFinished(complete, total, result)
+		}
+		m.Logger.Progress(complete, total)
+	}()
+
+	// Waiting happens before taking a slot, so projects waiting on others don't hold up independent ones
+	if err := m.waitForDependencies(ctx, project); err != nil {
+		m.Logger.Errorf("Skipping %s, %v", project.Name, err)
+		m.events.Printf("%s: skipped, %v", project.Name, err)
+		result.Skipped = true
+		result.Err = stageError(StageSchedule, err)
+		return
+	}
+
+	// The host slot is taken first, so projects waiting on a busy host don't hold slots projects on other hosts could use
+	defer m.acquireHost(ctx, project)()
+	if release := m.slots.acquire(ctx); release != nil {
+		defer release()
+	}
+	if ctx.Err() == nil {
+		m.waitForDisk(ctx, project)
+	}
+
+	// Projects that had yet to start when the migration was stopped are skipped
+	if ctx.Err() != nil {
+		m.Logger.Infof("Skipping %s, the migration was stopped", project.Name)
+		m.events.Printf("%s: skipped, the migration was stopped", project.Name)
+		result.Skipped = true
+		return
+	}
+	result.Start = time.Now()
+	m.queue.Start(project.Name)
+	m.events.Printf("%s: started", project.Name)
+	m.emit(Event{Event: "start", Project: project.Name})
+
+	// A project timeout overrides the global one
+	timeout := m.config.Timeout.Duration
+	if project.Timeout.Duration > 0 {
+		timeout = project.Timeout.Duration
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Every git and svn command of the project runs with its env
+	env := m.projectEnv(project)
+	ctx = withEnv(ctx, envList(env))
+	var script *bytes.Buffer
+	if m.Script != nil {
+		script = new(bytes.Buffer)
+		ctx = withScript(ctx, script)
+	}
+
+	// The manifest is trusted over the directory, which a crash can leave half written
+	if m.manifest.done(project.Name) && !m.Force && !m.Update {
+		m.Logger.Infof("%s was already migrated, skipping...", project.Name)
+		m.events.Printf("%s: skipped, the manifest has it as migrated", project.Name)
+		result.Skipped = true
+		return
+	}
+
+	dir := m.projectDir(project)
+	if len(m.config.BasePaths) > 0 {
+		result.BasePath = m.baseOf(project)
+	}
+	logPath := path.Join(m.config.LogDir, m.config.projectPath(project)+".log")
+	update := false
+	// Deepening a shallow clone means cloning it again, git svn can only fetch forward
+	deepen := m.Deepen && m.manifest.shallowFrom(project.Name) > 0
+	if _, err := os.Stat(dir); err == nil && (m.Force || deepen) {
+		// Refuse to remove anything that doesn't look like something we migrated
+		if _, err := os.Stat(path.Join(dir, ".git")); err != nil {
+			m.Logger.Errorf("Could not force %s: %s is not a git repository", project.Name, dir)
+			result.Err = stageError(StagePrepare, fmt.Errorf("%s is not a git repository", dir))
+			return
+		}
+		if m.DryRun {
+			m.Logger.Infof("Would remove %s", dir)
+		} else {
+			m.Logger.Infof("Removing %s...", project.Name)
+			if err := os.RemoveAll(dir); err != nil {
+				m.Logger.Errorf("Could not remove %s: %v", project.Name, err)
+				result.Err = stageError(StagePrepare, err)
+				return
+			}
+			// Rotated logs are kept so earlier attempts can still be compared
+			if m.config.LogRetain == 0 {
+				if err := os.Remove(logPath); err != nil && !os.IsNotExist(err) {
+					m.Logger.Errorf("Could not remove the log for %s: %v", project.Name, err)
+					result.Err = stageError(StagePrepare, err)
+					return
+				}
+			}
+		}
+	} else if err == nil {
+		// Skipping a half finished clone would ship a broken repository, so it fails until forced
+		if reason, ok := m.partial[project.Name]; ok {
+			m.Logger.Errorf("Could not migrate %s: %s looks partially cloned, use -force", project.Name, dir)
+			result.Err = stageError(StagePrepare, fmt.Errorf("%s looks partially cloned: %s", dir, reason))
+			return
+		}
+		if !m.Update {
+			if from := m.manifest.shallowFrom(project.Name); from > 0 {
+				m.Logger.Infof("%s already exists with history from r%d, use -deepen for the rest, skipping...", project.Name, from)
+				m.events.Printf("%s: skipped, it already exists with history from r%d", project.Name, from)
+				result.Skipped = true
+				return
+			}
+			m.Logger.Infof("%s already exists, skipping...", project.Name)
+			m.events.Printf("%s: skipped, it already exists", project.Name)
+			result.Skipped = true
+			return
+		}
+		// The repository a dump was loaded into is gone, and the dump has nothing new anyway
+		if project.Dump != "" {
+			m.Logger.Infof("%s was migrated from a dump, which has nothing to update, skipping...", project.Name)
+			m.events.Printf("%s: skipped, it was migrated from a dump", project.Name)
+			result.Skipped = true
+			return
+		}
+		if _, err := os.Stat(path.Join(dir, ".git", "svn")); err != nil {
+			m.Logger.Infof("%s already exists but is not a git-svn clone, skipping...", project.Name)
+			m.events.Printf("%s: skipped, it is not a git-svn clone", project.Name)
+			result.Skipped = true
+			return
+		}
+		if !m.Since.IsZero() && !m.DryRun {
+			changed, err := lastChanged(ctx, project)
+			if err != nil {
+				m.Logger.Errorf("Could not check when %s last changed, updating anyway: %v", project.Name, err)
+			} else if changed.Before(m.Since) {
+				m.Logger.Infof("%s has not changed since %s, skipping...", project.Name, m.Since.Format(time.RFC3339))
+				m.events.Printf("%s: skipped, unchanged since %s", project.Name, m.Since.Format(time.RFC3339))
+				result.Skipped = true
+				return
+			}
+		}
+		update = true
+		// Fetching only adds newer revisions, so a shallow clone stays shallow and -deepen can still find it
+		result.ShallowFrom = m.manifest.shallowFrom(project.Name)
+	}
+
+	if err := rotateLog(logPath, m.config.LogRetain); err != nil {
+		m.Logger.Errorf("Could not rotate the log for %s: %v", project.Name, err)
+	}
+	if m.config.CompressLogs {
+		if err := rotateLog(logPath+".gz", m.config.LogRetain); err != nil {
+			m.Logger.Errorf("Could not rotate the compressed log for %s: %v", project.Name, err)
+		}
+	}
+	logFile, err := m.createLog(logPath)
+	if err != nil {
+		m.Logger.Errorf("Could not create the log file for %s: %v", project.Name, err)
+		result.Err = stageError(StagePrepare, fmt.Errorf("could not create log file: %v", err))
+		return
+	}
+	// The log can only be compressed once nothing writes to it anymore
+	defer func() {
+		if err := logFile.Close(); err != nil {
+			m.Logger.Errorf("Could not close the log for %s: %v", project.Name, err)
+			return
+		}
+		if m.config.CompressLogs && !result.Skipped && !m.DryRun {
+			if err := m.compressLog(logPath); err != nil {
+				m.Logger.Errorf("Could not compress the log for %s: %v", project.Name, err)
+			}
+		}
+	}()
+	var out io.Writer = logFile
+	// Verbose output already goes to the console for every project
+	if project.Name == m.Tail && !m.Logger.Verbose() {
+		out = io.MultiWriter(logFile, m.Logger.Writer())
+	}
+	secrets := envSecrets(env)
+	if password := project.password(); password != "" {
+		secrets = append(secrets, password)
+	}
+	if len(secrets) > 0 {
+		out = &redactor{w: out, secrets: secrets}
+	}
+	if script != nil {
+		defer m.writeScript(project, envList(env), script, secrets)
+	}
+
+	// The pre_hook runs from the base path, since the directory of the project doesn't exist before it is cloned
+	// A project hook overrides the global one
+	preHook := m.config.PreHook
+	if len(project.PreHook) > 0 {
+		preHook = project.PreHook
+	}
+	if len(preHook) > 0 {
+		m.Logger.Infof("Running the pre_hook for %s...", project.Name)
+		if err := m.runHook(ctx, project, preHook, m.baseOf(project), out); err != nil {
+			m.Logger.Errorf("Could not run the pre_hook for %s, skipping the clone: %v", project.Name, err)
+			result.Err = stageError(StagePreHook, err)
+			return
+		}
+	}
+
+	// A dump is cloned from a repository of its own, which lives only as long as the project
+	if project.Dump != "" {
+		m.Logger.Infof("Loading the dump of %s...", project.Name)
+		url, tmp, err := m.loadDump(ctx, project, out)
+		if tmp != "" {
+			defer func() {
+				if err := os.RemoveAll(tmp); err != nil {
+					m.Logger.Errorf("Could not remove the repository loaded from the dump of %s: %v", project.Name, err)
+				}
+			}()
+		}
+		if err != nil {
+			m.Logger.Errorf("Could not load the dump of %s: %v", project.Name, err)
+			result.Err = stageError(StagePrepare, fmt.Errorf("could not load dump: %v", err))
+			return
+		}
+		project.SVN = url
+	}
+
+	// Detection only decides between std and not, so projects that are already std or have their own layout keep it
+	if m.detectLayout(project) && !project.Standard && !project.customLayout() {
+		if m.DryRun {
+			m.Logger.Infof("Would detect the layout of %s", project.Name)
+		} else {
+			std, err := standardLayout(ctx, project)
+			if err != nil {
+				m.Logger.Errorf("Could not detect the layout of %s: %v", project.Name, err)
+				result.Err = stageError(StagePrepare, fmt.Errorf("could not detect the layout: %v", err))
+				return
+			}
+			_, _ = fmt.Fprintf(out, "Detected a standard layout: %t\n", std)
+			m.Logger.Infof("Detected %s as std = %t", project.Name, std)
+			project.Standard = std
+		}
+	}
+
+	// A shallow clone only gets the most recent revisions, the boundary is kept in the manifest for -deepen
+	if n := m.shallowRevisions(project); n > 0 && !update && !deepen && project.Revision == "" {
+		if m.DryRun {
+			m.Logger.Infof("Would clone the last %d revisions of %s", n, project.Name)
+		} else {
+			head, err := headRevision(ctx, project)
+			if err != nil {
+				m.Logger.Errorf("Could not find the head revision of %s: %v", project.Name, err)
+				result.Err = stageError(StageClone, err)
+				return
+			}
+			result.ShallowFrom = head - n + 1
+			if result.ShallowFrom < 1 {
+				result.ShallowFrom = 1
+			}
+			project.Revision = fmt.Sprintf("%d:HEAD", result.ShallowFrom)
+		}
+	}
+
+	// Migration
+	migration := m.clone
+	if update {
+		m.Logger.Infof("Updating %s...", project.Name)
+		migration = m.fetch
+	} else {
+		m.Logger.Infof("Migrating %s...", project.Name)
+	}
+	// The clone gets a context of its own, so being too large can stop it without looking like a timeout
+	cloneCtx, stopClone := context.WithCancel(ctx)
+	stopWatching := m.watchSize(cloneCtx, dir, stopClone)
+	err = migration(cloneCtx, project, out)
+	over := stopWatching()
+	stopClone()
+	if over > 0 {
+		m.Logger.Errorf("Could not migrate %s, its .git is %d bytes, over the max_repo_size of %d", project.Name, over, m.config.MaxRepoSize)
+		_, _ = fmt.Fprintf(out, "Stopped: .git is %d bytes, over the max_repo_size of %d\n", over, m.config.MaxRepoSize)
+		result.Err = m.sizeError(over)
+		return
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			m.cancelled(ctx, project, timeout, out)
+			result.Err = stageError(StageClone, ctx.Err())
+			return
+		}
+		if reason := classifyLog(logPath); reason != "" {
+			m.Logger.Errorf("Could not migrate %s, %s: %v", project.Name, reason, err)
+			result.Err = &StageError{Stage: StageClone, Reason: reason, Err: err}
+			return
+		}
+		m.Logger.Errorf("Could not migrate %s: %v", project.Name, err)
+		result.Err = stageError(StageClone, err)
+		return
+	}
+
+	// An SVN path without any revisions clones "successfully" into a repository without commits
+	if !m.DryRun && m.isEmpty(ctx, dir, out) {
+		m.Logger.Errorf("%s has no commits, check its svn url", project.Name)
+		_, _ = fmt.Fprintln(out, "The clone has no commits")
+		result.Empty = true
+		return
+	}
+
+	// The range is read before cleanup, since a bare conversion leaves the git svn metadata behind
+	if !m.DryRun {
+		result.FirstRevision, result.LastRevision, err = revisionRange(dir)
+		if err != nil {
+			m.Logger.Errorf("Could not read the revision range of %s: %v", project.Name, err)
+			m.events.Printf("%s: error: could not read the revision range: %v", project.Name, err)
+		} else {
+			_, _ = fmt.Fprintf(out, "Migrated svn revisions r%d to r%d\n", result.FirstRevision, result.LastRevision)
+		}
+	}
+
+	// Cleanup problems are logged rather than failing the project, the repository is still usable
+	// With strict_cleanup a repository that wasn't fully converted isn't pushed or counted as migrated
+	stage := StageCleanup
+	result.CleanupErrors = m.cleanup(ctx, project, dir, out)
+	if len(result.CleanupErrors) > 0 && m.config.StrictCleanup {
+		result.Err = stageError(stage, cleanupError(result.CleanupErrors))
+		return
+	}
+
+	// git svn clone skips svn:externals, so they are at least pointed out
+	if !m.DryRun && !m.noSVN && ctx.Err() == nil {
+		exts, err := externals(ctx, project, out)
+		if err != nil {
+			m.Logger.Errorf("Could not check the svn:externals of %s: %v", project.Name, err)
+			m.events.Printf("%s: error: could not check svn:externals: %v", project.Name, err)
+		}
+		if len(exts) > 0 {
+			m.Logger.Printf("Warning: %s has %d svn:externals which were not migrated, see its log", project.Name, len(exts))
+			m.events.Printf("%s: warning: %d svn:externals were not migrated", project.Name, len(exts))
+			for _, ext := range exts {
+				_, _ = fmt.Fprintf(out, "Warning: external %s in %s from %s was not migrated\n", ext.Dir, ext.Owner, ext.URL)
+			}
+		}
+		if m.config.FetchExternals && len(exts) > 0 {
+			if err := m.fetchExternals(ctx, project, exts, out); err != nil {
+				m.Logger.Errorf("Could not fetch the svn:externals of %s: %v", project.Name, err)
+				m.events.Printf("%s: error: could not fetch svn:externals: %v", project.Name, err)
+			}
+		}
+	}
+
+	// The note goes on before gc, so it is packed along with everything else
+	if m.config.MigrationNote {
+		m.Logger.Infof("Adding a migration note to %s...", project.Name)
+		if err := m.addNote(ctx, project, result.FirstRevision, result.LastRevision, dir, out); err != nil {
+			m.Logger.Errorf("Could not add a migration note to %s: %v", project.Name, err)
+			m.events.Printf("%s: error: could not add a migration note: %v", project.Name, err)
+		}
+	}
+
+	if m.config.GC {
+		m.Logger.Infof("Collecting garbage for %s...", project.Name)
+		if err := m.collectGarbage(ctx, dir, out); err != nil {
+			m.Logger.Errorf("Could not collect garbage for %s: %v", project.Name, err)
+			m.events.Printf("%s: error: could not collect garbage: %v", project.Name, err)
+		}
+	}
+
+	if m.config.Verify && !m.DryRun {
+		stage = StageVerify
+		m.Logger.Infof("Verifying %s...", project.Name)
+		revisions, commits, err := m.verify(ctx, project, dir, out)
+		result.SVNRevisions, result.GitCommits = revisions, commits
+		if err != nil {
+			m.Logger.Errorf("Could not verify %s: %v", project.Name, err)
+			result.Err = stageError(StageVerify, err)
+		}
+	}
+
+	// A project hook overrides the global one
+	postHook := m.config.PostHook
+	if len(project.PostHook) > 0 {
+		postHook = project.PostHook
+	}
+	if len(postHook) > 0 && ctx.Err() == nil {
+		stage = StageHook
+		m.Logger.Infof("Running the post_hook for %s...", project.Name)
+		if err := m.runHook(ctx, project, postHook, dir, out); err != nil {
+			m.Logger.Errorf("Could not run the post_hook for %s: %v", project.Name, err)
+			result.Err = stageError(StageHook, err)
+		}
+	}
+
+	if (m.config.Bare || project.Bare) && ctx.Err() == nil {
+		stage = StageBare
+		m.Logger.Infof("Creating a bare repository for %s...", project.Name)
+		if err := m.bareClone(ctx, project, dir, out); err != nil {
+			m.Logger.Errorf("Could not create a bare repository for %s: %v", project.Name, err)
+			result.Err = stageError(StageBare, err)
+		}
+	}
+
+	if m.push != nil && ctx.Err() == nil {
+		stage = StagePush
+		remote, err := m.pushMirror(ctx, project, dir, out)
+		if err != nil {
+			m.Logger.Errorf("Could not push %s: %v", project.Name, err)
+			result.Err = stageError(StagePush, err)
+		} else {
+			m.Logger.Infof("Pushed %s to %s", project.Name, remote)
+			result.Pushed = remote
+		}
+	}
+
+	// Bundling comes last, so the bundle has every ref the repository ends up with
+	if m.config.Bundle && result.Err == nil && ctx.Err() == nil {
+		stage = StageBundle
+		m.Logger.Infof("Bundling %s...", project.Name)
+		file, sum, err := m.bundle(ctx, project, dir, out)
+		if err != nil {
+			m.Logger.Errorf("Could not bundle %s: %v", project.Name, err)
+			result.Err = stageError(StageBundle, err)
+		} else {
+			result.Bundle, result.BundleSHA256 = file, sum
+		}
+	}
+
+	if ctx.Err() != nil {
+		m.cancelled(ctx, project, timeout, out)
+		result.Err = stageError(stage, ctx.Err())
+	}
+}
+
+// detectLayout is whether the layout of project is detected, a project's own detect_layout wins over the config's
+func (m *Migrator) detectLayout(project Project) bool {
+	if project.DetectLayout != nil {
+		return *project.DetectLayout
+	}
+	return m.config.DetectLayout
+}
+
+// shallowRevisions is how many recent revisions to clone of project, a project's shallow_revisions overrides the global one
+func (m *Migrator) shallowRevisions(project Project) int {
+	if project.ShallowRevisions > 0 {
+		return project.ShallowRevisions
+	}
+	return m.config.ShallowRevisions
+}
+
+// cleanup converts the refs git-svn leaves behind in dir into git tags and branches
+// Each project is cleaned up in its own directory through cmd.Dir, so cleanups of different projects overlap freely
+// The steps within a project stay sequential: branches are listed from what tags leave under refs/remotes,
+// and concurrent ref updates in one repository contend for the same ref locks
+func (m *Migrator) cleanup(ctx context.Context, project Project, dir string, out io.Writer) []error {
+	var errs []error
+
+	// Excluded refs are dropped first, so neither the built-in conversion nor a script sees them
+	var excluded map[string]bool
+	if len(project.ExcludeRefs) > 0 {
+		m.Logger.Infof("Excluding refs for %s...", project.Name)
+		recordLine(ctx, dir, excludeShell(project, m.config.PruneBranches))
+		var err error
+		if excluded, err = m.excludeRefs(withoutScript(ctx), project, dir, out); err != nil {
+			m.Logger.Errorf("Could not exclude refs for %s: %v", project.Name, err)
+			m.events.Printf("%s: error: could not exclude refs: %v", project.Name, err)
+			errs = append(errs, fmt.Errorf("could not exclude refs: %v", err))
+		}
+	}
+
+	// Tags
+	m.Logger.Infof("Converting tags for %s...", project.Name)
+	if err := m.cleanupStep(ctx, project, tagsScript, dir, out, m.convertTags); err != nil {
+		m.Logger.Errorf("Could not convert tags for %s: %v", project.Name, err)
+		m.events.Printf("%s: error: could not convert tags: %v", project.Name, err)
+		errs = append(errs, fmt.Errorf("could not convert tags: %v", err))
+	}
+
+	// Branches
+	m.Logger.Infof("Converting branches for %s...", project.Name)
+	if err := m.cleanupStep(ctx, project, branchesScript, dir, out, m.convertBranches); err != nil {
+		m.Logger.Errorf("Could not convert branches for %s: %v", project.Name, err)
+		m.events.Printf("%s: error: could not convert branches: %v", project.Name, err)
+		errs = append(errs, fmt.Errorf("could not convert branches: %v", err))
+	}
+
+	// Peg-revisions
+	m.Logger.Infof("Converting peg-revisions for %s...", project.Name)
+	if err := m.cleanupStep(ctx, project, pegsScript, dir, out, m.deletePegs); err != nil {
+		m.Logger.Errorf("Could not convert the peg-revisions for %s: %v", project.Name, err)
+		m.events.Printf("%s: error: could not convert peg-revisions: %v", project.Name, err)
+		errs = append(errs, fmt.Errorf("could not convert peg-revisions: %v", err))
+	}
+
+	// With -update the branch is only converted again when git svn fetch brought back its ref with new commits
+	oldBranch := project.trunkRef()
+	old := m.gitCommand(ctx, dir, "branch", "-d", oldBranch)
+	if m.Update {
+		old = m.gitCommand(withoutScript(ctx), dir, "branch", "-d", oldBranch)
+		recordLine(ctx, dir, ifRefShell("refs/heads/"+oldBranch, commandLine(old)))
+	}
+	m.Logger.Infof("Deleting the %s branch...", oldBranch)
+	if m.Update && !m.hasRef(withoutScript(ctx), dir, out, "refs/heads/"+oldBranch) {
+		_, _ = fmt.Fprintf(out, "%s has no new commits\n", oldBranch)
+	} else if err := m.run(old, out); err != nil {
+		m.Logger.Errorf("Could not delete the %s branch: %v", oldBranch, err)
+		m.events.Printf("%s: error: could not delete the %s branch: %v", project.Name, oldBranch, err)
+		errs = append(errs, fmt.Errorf("could not delete the %s branch: %v", oldBranch, err))
+	}
+
+	if m.config.PruneBranches {
+		m.Logger.Infof("Pruning empty branches for %s...", project.Name)
+		recordLine(ctx, dir, pruneShell())
+		if err := m.pruneBranches(withoutScript(ctx), project, dir, out, excluded); err != nil {
+			m.Logger.Errorf("Could not prune the empty branches of %s: %v", project.Name, err)
+			m.events.Printf("%s: error: could not prune empty branches: %v", project.Name, err)
+			errs = append(errs, fmt.Errorf("could not prune empty branches: %v", err))
+		}
+	}
+	return errs
+}
+
+// runHook runs a user supplied command in dir, which can find out about the project from its environment
+// MIGRATE_DIR is always the directory of the project, even for hooks that run before it exists
+// The script gets the hook with its variables in front, since command only records the arguments
+func (m *Migrator) runHook(ctx context.Context, project Project, hook []string, dir string, out io.Writer) error {
+	env := []string{"MIGRATE_NAME=" + project.Name, "MIGRATE_SVN=" + project.SVN, "MIGRATE_DIR=" + m.projectDir(project), "MIGRATE_PREFIX=" + project.Prefix}
+	cmd := command(withoutScript(ctx), dir, hook[0], hook[1:]...)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = append(cmd.Env, env...)
+	recordLine(ctx, dir, envShell(env)+commandLine(cmd))
+	return m.run(cmd, out)
+}
+
+// isEmpty is whether the repository in dir has no commits
+func (m *Migrator) isEmpty(ctx context.Context, dir string, out io.Writer) bool {
+	count := m.gitCommand(ctx, dir, "rev-list", "--count", "HEAD")
+	count.Stderr = out
+	stdout, err := count.Output()
+	if err != nil {
+		return true
+	}
+	return strings.TrimSpace(string(stdout)) == "0"
+}
+
+// collectGarbage runs git gc in dir and logs how much it shrank .git
+func (m *Migrator) collectGarbage(ctx context.Context, dir string, out io.Writer) error {
+	gitDir := path.Join(dir, ".git")
+	before, _ := dirSize(gitDir)
+
+	args := []string{"gc"}
+	if m.config.GCAggressive {
+		args = append(args, "--aggressive")
+	}
+	gc := m.gitCommand(ctx, dir, args...)
+	if err := m.run(gc, out); err != nil {
+		return err
+	}
+
+	after, _ := dirSize(gitDir)
+	_, _ = fmt.Fprintf(out, ".git size before gc: %d bytes, after gc: %d bytes\n", before, after)
+	return nil
+}
+
+// dirSize adds up the size of every file under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// clone runs git svn clone, retrying with exponential backoff up to m.config.MaxRetries times
+func (m *Migrator) clone(ctx context.Context, project Project, out io.Writer) error {
+	if project.Revision != "" {
+		_, _ = fmt.Fprintf(out, "Cloning revisions %s\n", project.Revision)
+	}
+	if project.IgnorePaths != "" {
+		_, _ = fmt.Fprintf(out, "Ignoring paths matching %s\n", project.IgnorePaths)
+	}
+
+	// Shard directories are shared between projects, so they are created up front rather than by git
+	if m.config.Shard > 0 && !m.DryRun {
+		if err := os.MkdirAll(path.Dir(m.projectDir(project)), os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		migration := m.gitCommand(ctx, m.baseOf(project), m.cloneArgs(project)...)
+		// git-svn prompts for the password, so it never shows up in the arguments
+		if password := project.password(); password != "" {
+			migration.Stdin = strings.NewReader(password + "\n")
+		}
+		err := m.run(migration, out)
+		if err == nil || attempt >= m.config.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		// A failed clone leaves a partial directory behind, which would otherwise be skipped
+		recordLine(ctx, "", "rm -rf "+shellQuote(m.projectDir(project)))
+		if err := os.RemoveAll(m.projectDir(project)); err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(out, "Clone failed: %v, retry %d/%d in %s\n", err, attempt+1, m.config.MaxRetries, backoff)
+		m.Logger.Infof("Retrying %s in %s...", project.Name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// fetch runs git svn fetch in an already migrated project and fast-forwards its checkout
+func (m *Migrator) fetch(ctx context.Context, project Project, out io.Writer) error {
+	dir := m.projectDir(project)
+
+	fetchArgs := []string{"svn", "fetch"}
+	if m.SVNConfigDir != "" {
+		fetchArgs = append(fetchArgs, "--config-dir="+m.SVNConfigDir)
+	}
+	if project.Username != "" {
+		fetchArgs = append(fetchArgs, "--username="+project.Username)
+	}
+	svnFetch := m.gitCommand(ctx, dir, fetchArgs...)
+	// Like git svn clone, fetch prompts for the password
+	if password := project.password(); password != "" {
+		svnFetch.Stdin = strings.NewReader(password + "\n")
+	}
+	if err := m.run(svnFetch, out); err != nil {
+		return err
+	}
+
+	// The first run's cleanup converted the trunk ref, and git svn fetch only brings it back with new commits
+	trunk := "refs/remotes/" + project.Prefix + project.trunkRef()
+	merge := m.gitCommand(withoutScript(ctx), dir, "merge", "--ff-only", trunk)
+	recordLine(ctx, dir, ifRefShell(trunk, commandLine(merge)))
+	if !m.hasRef(withoutScript(ctx), dir, out, trunk) {
+		_, _ = fmt.Fprintf(out, "%s has no new commits\n", trunk)
+		return nil
+	}
+	return m.run(merge, out)
+}
+
+// cloneArgs builds the git arguments to clone project
+func (m *Migrator) cloneArgs(project Project) []string {
+	args := []string{"svn", "clone", project.SVN, "--authors-file=" + m.authorsFileOf(project)}
+	// --no-metadata leaves the git-svn-id trailer off every commit message, which is cleaner once SVN is retired
+	// keep_metadata keeps them, so commits can be traced back to their SVN revision during the transition,
+	// at the cost of every message carrying the SVN url and repository uuid
+	if !m.config.KeepMetadata {
+		args = append(args, "--no-metadata")
+	}
+	if project.Username != "" {
+		args = append(args, "--username="+project.Username)
+	}
+	if m.SVNConfigDir != "" {
+		args = append(args, "--config-dir="+m.SVNConfigDir)
+	}
+	if project.Revision != "" {
+		args = append(args, "--revision="+project.Revision)
+	}
+	if project.IgnorePaths != "" {
+		args = append(args, "--ignore-paths="+project.IgnorePaths)
+	}
+
+	// git-svn defaults to an origin/ prefix, but the refs are kept directly under refs/remotes unless a prefix is set
+	// The prefix is passed as a single argument so an empty one can't be mistaken for another option
+	args = append(args, "--prefix="+project.Prefix)
+
+	switch {
+	case project.customLayout():
+		if project.Trunk != "" {
+			args = append(args, "--trunk="+project.Trunk)
+		}
+		if project.Branches != "" {
+			args = append(args, "--branches="+project.Branches)
+		}
+		if project.Tags != "" {
+			args = append(args, "--tags="+project.Tags)
+		}
+	case project.Standard:
+		args = append(args, "-s")
+	}
+
+	// Anything else git svn clone supports is passed through verbatim, global args first
+	args = append(args, m.config.ExtraArgs...)
+	args = append(args, project.ExtraArgs...)
+	return append(args, m.config.projectPath(project))
+}
+
+// bareClone clones the converted working clone in dir into a bare <name>.git next to it
+// It runs once cleanup is done, so the bare repository gets the converted tags and branches; the git-svn
+// metadata (.git/svn and refs/remotes) stays behind in the working clone, which -update keeps using
+// An existing bare repository is replaced, since it is only ever derived from the working clone
+func (m *Migrator) bareClone(ctx context.Context, project Project, dir string, out io.Writer) error {
+	bare := m.projectDir(project) + ".git"
+	if !m.DryRun {
+		if err := os.RemoveAll(bare); err != nil {
+			return err
+		}
+	}
+	clone := m.gitCommand(ctx, m.baseOf(project), "clone", "--bare", dir, bare)
+	if err := m.run(clone, out); err != nil {
+		return err
+	}
+
+	// git clone only brings along branches and tags, so the migration note is fetched separately
+	if !m.config.MigrationNote {
+		return nil
+	}
+	notes := m.gitCommand(ctx, bare, "fetch", dir, notesRef+":"+notesRef)
+	return m.run(notes, out)
+}
+
+// pushMirror mirrors the branches and tags of project to its push_remote
+// The url is pushed to directly rather than through a named remote, whose remote-tracking refs a later -update would
+// take for git svn refs; --prune still removes what no longer exists, like --mirror would
+func (m *Migrator) pushMirror(ctx context.Context, project Project, dir string, out io.Writer) (string, error) {
+	var remote strings.Builder
+	if err := m.push.Execute(&remote, project); err != nil {
+		return "", err
+	}
+
+	args := []string{"push", "--force", "--prune", remote.String(), "refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"}
+	if m.config.MigrationNote {
+		args = append(args, notesRef+":"+notesRef)
+	}
+	if err := m.run(m.gitCommand(ctx, dir, args...), out); err != nil {
+		return "", err
+	}
+	return remote.String(), nil
+}
+
+// cancelled notes in the console and the project log why the migration was cancelled
+func (m *Migrator) cancelled(ctx context.Context, project Project, timeout time.Duration, out io.Writer) {
+	if ctx.Err() == context.DeadlineExceeded {
+		m.Logger.Errorf("Migration of %s timed out after %s", project.Name, timeout)
+		_, _ = fmt.Fprintf(out, "Cancelled: timed out after %s\n", timeout)
+		return
+	}
+	m.Logger.Errorf("Migration of %s was stopped", project.Name)
+	_, _ = fmt.Fprintf(out, "Cancelled: %v\n", ctx.Err())
+}
+
+// createLog creates the log at logPath, creating its directory once if it has gone missing since the run started
+func (m *Migrator) createLog(logPath string) (*os.File, error) {
+	const flag = os.O_RDWR | os.O_CREATE | os.O_TRUNC
+	perm := m.config.fileMode(0666)
+	logFile, err := m.config.openFile(logPath, flag, perm)
+	if err == nil || !os.IsNotExist(err) {
+		return logFile, err
+	}
+	if err := os.MkdirAll(filepath.Dir(logPath), os.ModePerm); err != nil {
+		return nil, err
+	}
+	return m.config.openFile(logPath, flag, perm)
+}
+
+// compressLog gzips logPath into logPath.gz and removes it, leaving empty logs alone
+func (m *Migrator) compressLog(logPath string) error {
+	fi, err := os.Stat(logPath)
+	if err != nil {
+		return err
+	}
+	if fi.Size() == 0 {
+		return nil
+	}
+
+	in, err := os.Open(logPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := m.config.openFile(logPath+".gz", os.O_RDWR|os.O_CREATE|os.O_TRUNC, m.config.fileMode(0666))
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(logPath)
+}
+
+// rotateLog moves logPath to logPath.1, logPath.1 to logPath.2, and so on, keeping up to retain old logs
+func rotateLog(logPath string, retain int) error {
+	if retain <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(logPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	if err := os.Remove(fmt.Sprintf("%s.%d", logPath, retain)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for gen := retain - 1; gen >= 1; gen-- {
+		older := fmt.Sprintf("%s.%d", logPath, gen)
+		if err := os.Rename(older, fmt.Sprintf("%s.%d", logPath, gen+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(logPath, logPath+".1")
+}
+
+// gitPath is the configured git_path, or git from PATH
+func (m *Migrator) gitPath() string {
+	if m.config.GitPath != "" {
+		return m.config.GitPath
+	}
+	return "git"
+}
+
+// gitCommand builds a git command that runs in dir
+// Commands never change the process working directory, so projects can be converted concurrently
+func (m *Migrator) gitCommand(ctx context.Context, dir string, args ...string) *exec.Cmd {
+	return command(ctx, dir, m.gitPath(), args...)
+}
+
+// run logs cmd to out and runs it, unless this is a dry run
+func (m *Migrator) run(cmd *exec.Cmd, out io.Writer) error {
+	args := strings.Join(cmd.Args, " ")
+	_, _ = fmt.Fprintf(out, "%s\n", args)
+	if m.DryRun {
+		m.Logger.Infof("Would run: %s", args)
+		return nil
+	}
+
+	m.Logger.Debugf("Running: %s", args)
+	if m.Logger.Verbose() {
+		out = m.withConsole(out)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+// withConsole also writes what goes to out to the Logger, hiding the secrets out hides
+func (m *Migrator) withConsole(out io.Writer) io.Writer {
+	console := m.Logger.Writer()
+	if r, ok := out.(*redactor); ok {
+		console = &redactor{w: console, secrets: r.secrets}
+	}
+	return io.MultiWriter(out, console)
+}
+
+// preflight makes sure the tools every migration needs are installed
+func (m *Migrator) preflight() error {
+	if err := exec.Command(m.gitPath(), "svn", "--version").Run(); err != nil {
+		return fmt.Errorf("git-svn not found, install the git-svn package or set git_path: %v", err)
+	}
+	if m.config.hasDumps() {
+		if err := exec.Command("svnadmin", "--version", "--quiet").Run(); err != nil {
+			return fmt.Errorf("svnadmin not found, install subversion to load dump files: %v", err)
+		}
+	}
+	// svn itself is needed to generate users.txt, checking svn:externals is skipped without it
+	if err := exec.Command("svn", "--version", "--quiet").Run(); err != nil {
+		if m.config.UsersPath == "" {
+			return fmt.Errorf("svn not found, install subversion or set users_path: %v", err)
+		}
+		m.Logger.Printf("Warning: svn not found, the svn:externals of projects will not be checked: %v", err)
+		m.noSVN = true
+	}
+	return nil
+}
+
+func (m *Migrator) checkAssets() error {
+	if err := os.MkdirAll(m.config.LogDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// Projects with their own users_path don't need the shared users.txt, nor take part in generating it
+	var shared []Project
+	for _, project := range m.config.Projects {
+		if project.UsersPath == "" {
+			shared = append(shared, project)
+		}
+	}
+
+	var users []byte
+	if m.config.UsersPath == "" {
+		generated, err := m.generateUsers(shared, m.authorDomain())
+		if err != nil {
+			return err
+		}
+		users = generated
+		m.Logger.Infof("Generated users.txt from the SVN logs")
+	} else {
+		fiup, err := os.Open(m.config.UsersPath)
+		if err != nil {
+			return err
+		}
+		defer fiup.Close()
+
+		users, err = ioutil.ReadAll(fiup)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.authorsFile = filepath.Join(m.config.BasePath, "users.txt")
+	fiu, err := m.config.openFile(m.authorsFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, m.config.fileMode(0666))
+	if err != nil {
+		return err
+	}
+	if _, err = fiu.Write(users); err != nil {
+		return err
+	}
+	defer fiu.Close()
+
+	if err := m.copyProjectAuthors(); err != nil {
+		return err
+	}
+	return m.copyScripts()
+}
+
+// cleanAssets removes what checkAssets generated, keeping users.txt if it is the user's own file
+func (m *Migrator) cleanAssets() error {
+	if m.config.UsersPath != "" {
+		abs, err := filepath.Abs(m.config.UsersPath)
+		if err != nil {
+			return err
+		}
+		if abs == m.authorsFile {
+			return m.cleanProjectAuthors()
+		}
+	}
+	if err := os.Remove(m.authorsFile); err != nil {
+		return err
+	}
+	return m.cleanProjectAuthors()
+}
+
+// redactor hides secrets from everything written through it
+type redactor struct {
+	w       io.Writer
+	secrets []string
+}
+
+func (r *redactor) Write(p []byte) (int, error) {
+	s := string(p)
+	for _, secret := range r.secrets {
+		s = strings.Replace(s, secret, "********", -1)
+	}
+	if _, err := io.WriteString(r.w, s); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
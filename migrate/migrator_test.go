@@ -0,0 +1,317 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+)
+
+func TestCloneArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		project Project
+		want    []string
+	}{
+		{
+			name:    "standard",
+			project: Project{Name: "a", SVN: "https://svn/a", Standard: true},
+			want:    []string{"svn", "clone", "https://svn/a", "--authors-file=/base/users.txt", "--no-metadata", "--prefix=", "-s", "a"},
+		},
+		{
+			name:    "non-standard",
+			project: Project{Name: "b", SVN: "https://svn/b"},
+			want:    []string{"svn", "clone", "https://svn/b", "--authors-file=/base/users.txt", "--no-metadata", "--prefix=", "b"},
+		},
+		{
+			name:    "custom layout",
+			project: Project{Name: "c", SVN: "https://svn/c", Standard: true, Trunk: "main", Tags: "releases"},
+			want:    []string{"svn", "clone", "https://svn/c", "--authors-file=/base/users.txt", "--no-metadata", "--prefix=", "--trunk=main", "--tags=releases", "c"},
+		},
+		{
+			name:    "prefix",
+			project: Project{Name: "d", SVN: "https://svn/d", Standard: true, Prefix: "svn/"},
+			want:    []string{"svn", "clone", "https://svn/d", "--authors-file=/base/users.txt", "--no-metadata", "--prefix=svn/", "-s", "d"},
+		},
+		{
+			name:    "keep metadata and extra args",
+			config:  Config{KeepMetadata: true, ExtraArgs: []string{"--log-window-size=1000"}},
+			project: Project{Name: "e", SVN: "https://svn/e", Dir: "old-e", Username: "jdoe", Revision: "10:HEAD", ExtraArgs: []string{"--no-minimize-url"}},
+			want:    []string{"svn", "clone", "https://svn/e", "--authors-file=/base/users.txt", "--username=jdoe", "--revision=10:HEAD", "--prefix=", "--log-window-size=1000", "--no-minimize-url", "old-e"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Migrator{config: tt.config, authorsFile: "/base/users.txt"}
+			if got := m.cloneArgs(tt.project); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("cloneArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCleanupConcurrent cleans up two repositories at once through a git_path that logs where each command runs
+func TestCleanupConcurrent(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the git_path stub is a shell script")
+	}
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "cleanup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	calls := filepath.Join(tmp, "calls.log")
+	stub := filepath.Join(tmp, "git")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$PWD\" >> %s\nexec %s \"$@\"\n", shellQuote(calls), shellQuote(git))
+	if err := ioutil.WriteFile(stub, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := make(map[string]string)
+	for _, name := range []string{"a", "b"} {
+		dir := filepath.Join(tmp, name)
+		for _, args := range [][]string{
+			{"init", "-q", dir},
+			{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", name},
+			{"-C", dir, "branch", "git-svn"},
+			{"-C", dir, "update-ref", "refs/remotes/tags/v1-" + name, "HEAD"},
+			{"-C", dir, "update-ref", "refs/remotes/feature-" + name, "HEAD"},
+		} {
+			if out, err := exec.Command(git, args...).CombinedOutput(); err != nil {
+				t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+			}
+		}
+		// The directory as the stub sees it, in case tmp is behind a symlink
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dirs[name] = resolved
+	}
+
+	m := &Migrator{
+		Logger: nopLogger{},
+		config: Config{GitPath: stub},
+		events: log.New(ioutil.Discard, "", 0),
+	}
+	var wg sync.WaitGroup
+	errs := make(map[string][]error)
+	var mu sync.Mutex
+	for name, dir := range dirs {
+		wg.Add(1)
+		go func(name, dir string) {
+			defer wg.Done()
+			var out bytes.Buffer
+			cleanupErrs := m.cleanup(context.Background(), Project{Name: name}, dir, &out)
+			mu.Lock()
+			errs[name] = cleanupErrs
+			mu.Unlock()
+		}(name, dir)
+	}
+	wg.Wait()
+
+	for name, dir := range dirs {
+		if len(errs[name]) > 0 {
+			t.Errorf("cleanup of %s failed: %v", name, errs[name])
+		}
+		out, err := exec.Command(git, "-C", dir, "for-each-ref", "--format=%(refname)").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The branch git init checks out depends on init.defaultBranch, so it is left out
+		got := withoutDefaultBranch(strings.Fields(string(out)))
+		sort.Strings(got)
+		want := []string{"refs/heads/feature-" + name, "refs/tags/v1-" + name}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("refs of %s = %q, want %q", name, got, want)
+		}
+	}
+
+	data, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, pwd := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		counts[pwd]++
+	}
+	if len(counts) != 2 || counts[dirs["a"]] == 0 || counts[dirs["a"]] != counts[dirs["b"]] {
+		t.Errorf("git ran in %v, want the same number of commands in %s and %s", counts, dirs["a"], dirs["b"])
+	}
+}
+
+// withoutDefaultBranch leaves out the branch git init checked out, whatever it is called
+func withoutDefaultBranch(refs []string) []string {
+	var kept []string
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref, "refs/heads/") || strings.HasPrefix(ref, "refs/heads/feature-") {
+			kept = append(kept, ref)
+		}
+	}
+	return kept
+}
+
+// TestUpdateUnchanged updates and pushes a migrated project twice when git svn fetch finds no new commits
+func TestUpdateUnchanged(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the git_path stub is a shell script")
+	}
+	git, err := exec.LookPath("git")
+	if err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// git svn fetch brings nothing back, so it does nothing at all
+	stub := filepath.Join(tmp, "git")
+	script := fmt.Sprintf("#!/bin/sh\n[ \"$1\" = svn ] && exit 0\nexec %s \"$@\"\n", shellQuote(git))
+	if err := ioutil.WriteFile(stub, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// The project as its first run left it, with every git svn ref converted
+	dir := filepath.Join(tmp, "app")
+	remote := filepath.Join(tmp, "remote.git")
+	for _, args := range [][]string{
+		{"init", "-q", dir},
+		{"-C", dir, "symbolic-ref", "HEAD", "refs/heads/master"},
+		{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "r1"},
+		{"-C", dir, "branch", "feature"},
+		{"-C", dir, "tag", "1.0"},
+		{"init", "-q", "--bare", remote},
+	} {
+		if out, err := exec.Command(git, args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "svn"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &Migrator{
+		Update: true,
+		Logger: nopLogger{},
+		config: Config{BasePath: tmp, GitPath: stub},
+		events: log.New(ioutil.Discard, "", 0),
+		push:   template.Must(template.New("push_remote").Parse(remote)),
+	}
+	project := Project{Name: "app", SVN: "https://svn/app", Standard: true}
+	want := refList(t, dir)
+	for run := 1; run <= 2; run++ {
+		ctx := context.Background()
+		if err := m.fetch(ctx, project, ioutil.Discard); err != nil {
+			t.Fatalf("update %d: fetch failed: %v", run, err)
+		}
+		if errs := m.cleanup(ctx, project, dir, ioutil.Discard); len(errs) > 0 {
+			t.Fatalf("update %d: cleanup failed: %v", run, errs)
+		}
+		if _, err := m.pushMirror(ctx, project, dir, ioutil.Discard); err != nil {
+			t.Fatalf("update %d: push failed: %v", run, err)
+		}
+		if got := refList(t, dir); got != want {
+			t.Errorf("update %d left refs\n%s\nwant\n%s", run, got, want)
+		}
+		if got := refList(t, remote); got != want {
+			t.Errorf("update %d pushed refs\n%s\nwant\n%s", run, got, want)
+		}
+	}
+}
+
+// TestStoppedSkipped stops a migration before any project starts, which skips them all without failing any
+func TestStoppedSkipped(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the git_path stub is a shell script")
+	}
+
+	tmp, err := ioutil.TempDir("", "stopped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// Only preflight runs git, to check for git svn
+	stub := filepath.Join(tmp, "git")
+	if err := ioutil.WriteFile(stub, []byte("#!/bin/sh\nexit 0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	users := filepath.Join(tmp, "users.txt")
+	if err := ioutil.WriteFile(users, []byte("jdoe = John Doe <jdoe@example.com>\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event struct {
+			Event string `json:"event"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&event)
+		mu.Lock()
+		posted = append(posted, event.Event)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	cfg := Config{
+		BasePath:        filepath.Join(tmp, "out"),
+		GitPath:         stub,
+		UsersPath:       users,
+		WebhookURL:      server.URL,
+		WebhookFailures: true,
+		Projects: []Project{
+			{Name: "a", SVN: "https://svn/a"},
+			{Name: "b", SVN: "https://svn/b"},
+			{Name: "c", SVN: "https://svn/c", DependsOn: []string{"a"}},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := (&Migrator{}).Run(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(cfg.Projects) {
+		t.Fatalf("got %d results, want %d", len(results), len(cfg.Projects))
+	}
+	for _, result := range results {
+		if status := result.Status(); status != "skipped" || result.Err != nil {
+			t.Errorf("%s is %s with error %v, want skipped without one", result.Project.Name, status, result.Err)
+		}
+	}
+	if failed := results.Failed(); len(failed) > 0 {
+		t.Errorf("%d projects failed, want none", len(failed))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(posted, []string{"finished"}) {
+		t.Errorf("the webhook got %q, want only finished", posted)
+	}
+}
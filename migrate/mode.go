@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"os"
+	"strconv"
+)
+
+// parseFileMode reads an octal file_mode such as "0640"
+func parseFileMode(mode string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(perm) & os.ModePerm, nil
+}
+
+// fileMode is the file_mode of c, or def if it is unset, Validate catches modes that don't parse
+func (c Config) fileMode(def os.FileMode) os.FileMode {
+	if c.FileMode == "" {
+		return def
+	}
+	perm, err := parseFileMode(c.FileMode)
+	if err != nil {
+		return def
+	}
+	return perm
+}
+
+// scriptMode is the file_mode of c with an execute bit for everyone who can read, so scripts can run on their own
+func (c Config) scriptMode() os.FileMode {
+	if c.FileMode == "" {
+		return 0755
+	}
+	perm := c.fileMode(0644)
+	return perm | (perm&0444)>>2
+}
+
+// openFile opens name with flag, creating it with perm
+// With file_mode set, perm is applied even to files that already existed, and regardless of the umask
+func (c Config) openFile(name string, flag int, perm os.FileMode) (*os.File, error) {
+	fi, err := os.OpenFile(name, flag, perm)
+	if err != nil || c.FileMode == "" {
+		return fi, err
+	}
+	if err := fi.Chmod(perm); err != nil {
+		fi.Close()
+		return nil, err
+	}
+	return fi, nil
+}
+
+// writeFile writes data to name like ioutil.WriteFile, through openFile
+func (c Config) writeFile(name string, data []byte, perm os.FileMode) error {
+	fi, err := c.openFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := fi.Write(data); err != nil {
+		fi.Close()
+		return err
+	}
+	return fi.Close()
+}
+
+// WriteFile writes data to name with the file_mode of c, or 0644 without one, for files written outside a run such as the report
+func (c Config) WriteFile(name string, data []byte) error {
+	return c.writeFile(name, data, c.fileMode(0644))
+}
+
+// CreateExecutable creates name, or empties it, with the file_mode of c plus execute bits like the copied cleanup scripts
+func (c Config) CreateExecutable(name string) (*os.File, error) {
+	return c.openFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, c.scriptMode())
+}
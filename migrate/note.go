@@ -0,0 +1,31 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Version is the version of go-migrate recorded in migration notes, set at build time with
+// -ldflags "-X go-migrate/migrate.Version=v1.2.3"
+var Version = "dev"
+
+// notesRef is where git notes add puts notes by default
+const notesRef = "refs/notes/commits"
+
+// addNote attaches a git note to the tip of the repository in dir, recording where and when it was migrated from
+func (m *Migrator) addNote(ctx context.Context, project Project, first, last int, dir string, out io.Writer) error {
+	var note strings.Builder
+	_, _ = fmt.Fprintf(&note, "Migrated from %s\n\n", project.SVN)
+	_, _ = fmt.Fprintf(&note, "Date: %s\n", time.Now().UTC().Format(time.RFC3339))
+	if last > 0 {
+		_, _ = fmt.Fprintf(&note, "Revisions: r%d-r%d\n", first, last)
+	}
+	_, _ = fmt.Fprintf(&note, "Tool: go-migrate %s\n", Version)
+
+	// -f replaces the note of an earlier run, e.g. one with -update that found no new commits
+	add := m.gitCommand(ctx, dir, "notes", "add", "-f", "-m", note.String(), "HEAD")
+	return m.run(add, out)
+}
@@ -0,0 +1,41 @@
+package migrate
+
+import (
+	"os"
+	"path"
+)
+
+// partialClone explains why the existing project directory dir looks like a clone that was interrupted, if it does
+// It is conservative, a directory without .git/svn is never called partial since it may not be ours at all
+func partialClone(dir string) string {
+	if _, err := os.Stat(path.Join(dir, ".git", "index.lock")); err == nil {
+		return "git left an index.lock behind"
+	}
+	if _, err := os.Stat(path.Join(dir, ".git", "svn")); err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path.Join(dir, ".git", "svn", ".metadata")); os.IsNotExist(err) {
+		return "git svn never finished fetching"
+	}
+	return ""
+}
+
+// findPartialClones checks every project that the manifest doesn't have as migrated for a partial clone
+// With -force they are removed and migrated again like any other existing project, so there is nothing to find
+func (m *Migrator) findPartialClones(projects []Project) map[string]string {
+	partial := make(map[string]string)
+	if m.Force {
+		return partial
+	}
+	for _, project := range projects {
+		if m.manifest.done(project.Name) {
+			continue
+		}
+		dir := m.config.findDir(project)
+		if reason := partialClone(dir); reason != "" {
+			m.Logger.Printf("Warning: %s looks partially cloned, %s, use -force to migrate it again", project.Name, reason)
+			partial[project.Name] = reason
+		}
+	}
+	return partial
+}
@@ -0,0 +1,126 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Reconciliation compares the projects of a config with the directories in its base_path
+type Reconciliation struct {
+	// Migrated projects have a directory that looks like a finished clone
+	Migrated []string
+	// Pending projects have no directory yet
+	Pending []string
+	// Missing projects are recorded as migrated in the manifest, but their directory is gone
+	// Runs skip them until -force or -reset is used
+	Missing []string
+	// Incomplete projects have a directory that is not a finished clone
+	Incomplete []Incomplete
+	// Orphans are directories in base_path that no project of the config would migrate to
+	// With base_paths they are looked for in each of them, and are full paths
+	Orphans []string
+}
+
+// Incomplete is a project directory that exists but is not a finished clone, and why
+type Incomplete struct {
+	Name   string
+	Reason string
+}
+
+// Reconcile sorts every project of cfg by the state of its directory, and finds the directories no project accounts for
+// It only reads base_path and the manifest, nothing is run or changed
+func Reconcile(cfg Config) (Reconciliation, error) {
+	var r Reconciliation
+	cfg, err := resolveConfig(cfg)
+	if err != nil {
+		return r, err
+	}
+	manifest, err := loadManifest(path.Join(cfg.BasePath, "manifest.json"), cfg)
+	if err != nil {
+		return r, err
+	}
+
+	expected := make(map[string]bool)
+	for _, project := range cfg.Projects {
+		rel := cfg.projectPath(project)
+		expected[rel] = true
+		expected[rel+".git"] = true
+
+		dir := cfg.findDir(project)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if manifest.done(project.Name) {
+				r.Missing = append(r.Missing, project.Name)
+			} else {
+				r.Pending = append(r.Pending, project.Name)
+			}
+			continue
+		}
+		if _, err := os.Stat(path.Join(dir, ".git")); err != nil {
+			r.Incomplete = append(r.Incomplete, Incomplete{Name: project.Name, Reason: "it is not a git repository, which -force leaves alone"})
+			continue
+		}
+		if reason := partialClone(dir); reason != "" {
+			r.Incomplete = append(r.Incomplete, Incomplete{Name: project.Name, Reason: reason})
+			continue
+		}
+		r.Migrated = append(r.Migrated, project.Name)
+	}
+
+	for _, base := range cfg.repoBases() {
+		found, err := orphans(cfg, base, expected)
+		if err != nil {
+			return r, err
+		}
+		for _, rel := range found {
+			if len(cfg.BasePaths) > 0 {
+				rel = filepath.Join(base, rel)
+			}
+			r.Orphans = append(r.Orphans, rel)
+		}
+	}
+	return r, nil
+}
+
+// orphans lists the directories in base, or in its shard directories, that aren't in expected
+// The log_dir and hidden directories are left out, they are never projects
+func orphans(cfg Config, base string, expected map[string]bool) ([]string, error) {
+	entries, err := ioutil.ReadDir(base)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if filepath.Clean(filepath.Join(base, entry.Name())) == filepath.Clean(cfg.LogDir) {
+			continue
+		}
+		if cfg.Shard <= 0 {
+			if !expected[entry.Name()] {
+				found = append(found, entry.Name())
+			}
+			continue
+		}
+		children, err := ioutil.ReadDir(filepath.Join(base, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, child := range children {
+			rel := path.Join(entry.Name(), child.Name())
+			if child.IsDir() && !expected[rel] {
+				found = append(found, rel)
+			}
+		}
+	}
+	sort.Strings(found)
+	return found, nil
+}
@@ -0,0 +1,214 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// refs returns the short names of the refs in dir matching patterns
+func (m *Migrator) refs(ctx context.Context, dir string, out io.Writer, patterns ...string) ([]string, error) {
+	stdout, err := m.output(ctx, dir, out, append([]string{"for-each-ref", "--format=%(refname:short)"}, patterns...)...)
+	return strings.Fields(stdout), err
+}
+
+// output runs a read-only git command in dir and returns what it printed, or nothing in a dry run
+func (m *Migrator) output(ctx context.Context, dir string, out io.Writer, args ...string) (string, error) {
+	cmd := m.gitCommand(ctx, dir, args...)
+	_, _ = fmt.Fprintf(out, "%s\n", strings.Join(cmd.Args, " "))
+	if m.DryRun {
+		m.Logger.Infof("Would run: %s", strings.Join(cmd.Args, " "))
+		return "", nil
+	}
+
+	m.Logger.Debugf("Running: %s", strings.Join(cmd.Args, " "))
+	cmd.Stderr = out
+	if m.Logger.Verbose() {
+		cmd.Stderr = m.withConsole(out)
+	}
+	stdout, err := cmd.Output()
+	return string(stdout), err
+}
+
+// hasRef is whether ref exists in dir, a dry run has every ref
+func (m *Migrator) hasRef(ctx context.Context, dir string, out io.Writer, ref string) bool {
+	_, err := m.output(ctx, dir, out, "rev-parse", "--verify", "-q", ref)
+	return err == nil
+}
+
+// remotes returns the git svn refs of project in dir without their prefix, e.g. tags/1.0 or feature
+func (m *Migrator) remotes(ctx context.Context, project Project, dir string, out io.Writer) ([]string, error) {
+	all, err := m.refs(ctx, dir, out, "refs/remotes")
+	if err != nil {
+		return nil, err
+	}
+
+	// for-each-ref patterns only match whole path components, so a prefix such as svn- is filtered here
+	var remotes []string
+	for _, r := range all {
+		if strings.HasPrefix(r, project.Prefix) {
+			remotes = append(remotes, strings.TrimPrefix(r, project.Prefix))
+		}
+	}
+	return remotes, nil
+}
+
+// excludeRefs deletes the remote branches and tags of project matching its exclude_refs, before they are converted
+// Patterns are matched with path.Match against the git svn name of the ref without its prefix, e.g. tags/1.0-rc1 or dev-jdoe
+// It returns the commits the deleted refs pointed to, so pruneBranches can find local branches left at them
+func (m *Migrator) excludeRefs(ctx context.Context, project Project, dir string, out io.Writer) (map[string]bool, error) {
+	remotes, err := m.remotes(ctx, project, dir, out)
+	if err != nil {
+		return nil, err
+	}
+
+	tips := make(map[string]bool)
+	var lastErr error
+	for _, r := range remotes {
+		if !matchAny(project.ExcludeRefs, r) {
+			continue
+		}
+		tip, err := m.output(ctx, dir, out, "rev-parse", "refs/remotes/"+project.Prefix+r)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if err := m.run(m.gitCommand(ctx, dir, "branch", "-D", "-r", project.Prefix+r), out); err != nil {
+			lastErr = err
+			continue
+		}
+		if tip = strings.TrimSpace(tip); tip != "" {
+			tips[tip] = true
+		}
+		_, _ = fmt.Fprintf(out, "Excluded %s\n", r)
+		m.events.Printf("%s: excluded %s", project.Name, r)
+	}
+	return tips, lastErr
+}
+
+// matchAny is whether name matches any of patterns, which are checked by Validate
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// convertTags turns every remote tag branch into a real git tag
+func (m *Migrator) convertTags(ctx context.Context, project Project, dir string, out io.Writer) error {
+	remotes, err := m.remotes(ctx, project, dir, out)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, t := range remotes {
+		if !strings.HasPrefix(t, "tags/") {
+			continue
+		}
+		remote := project.Prefix + t
+		if err := m.run(m.gitCommand(ctx, dir, "tag", strings.TrimPrefix(t, "tags/"), remote), out); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := m.run(m.gitCommand(ctx, dir, "branch", "-D", "-r", remote), out); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// convertBranches turns every remaining remote branch into a local branch
+// With -update the local branches already exist, git svn fetch only brings back the remote refs of branches with
+// new commits, so those are moved forward with update-ref; full ref names keep them from being ambiguous
+func (m *Migrator) convertBranches(ctx context.Context, project Project, dir string, out io.Writer) error {
+	branches, err := m.remotes(ctx, project, dir, out)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, b := range branches {
+		remote := project.Prefix + b
+		convert := m.gitCommand(ctx, dir, "branch", b, "refs/remotes/"+remote)
+		if m.Update {
+			convert = m.gitCommand(ctx, dir, "update-ref", "refs/heads/"+b, "refs/remotes/"+remote)
+		}
+		if err := m.run(convert, out); err != nil {
+			lastErr = err
+			continue
+		}
+		if err := m.run(m.gitCommand(ctx, dir, "branch", "-D", "-r", remote), out); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// deletePegs removes the branches git-svn creates for peg-revisions, e.g. branch@1234
+func (m *Migrator) deletePegs(ctx context.Context, project Project, dir string, out io.Writer) error {
+	all, err := m.refs(ctx, dir, out)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, p := range all {
+		if !strings.Contains(p, "@") {
+			continue
+		}
+		if err := m.run(m.gitCommand(ctx, dir, "branch", "-D", p), out); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// emptyTree is the hash git gives a tree without any files
+const emptyTree = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// pruneBranches deletes the local branches of dir whose tip has no files, such as those git svn makes for
+// branches that were created from an empty path, and those whose tip is one of the excluded commits, which
+// exclude_refs deleted the remote ref of; the checked out branch is always kept
+func (m *Migrator) pruneBranches(ctx context.Context, project Project, dir string, out io.Writer, excluded map[string]bool) error {
+	branches, err := m.refs(ctx, dir, out, "refs/heads")
+	if err != nil {
+		return err
+	}
+	head, _ := m.output(ctx, dir, out, "symbolic-ref", "--short", "HEAD")
+	head = strings.TrimSpace(head)
+
+	var lastErr error
+	for _, b := range branches {
+		if b == head {
+			continue
+		}
+		tips, err := m.output(ctx, dir, out, "rev-parse", "refs/heads/"+b, "refs/heads/"+b+"^{tree}")
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var reason string
+		switch fields := strings.Fields(tips); {
+		case len(fields) != 2:
+			continue
+		case fields[1] == emptyTree:
+			reason = "it has no files"
+		case excluded[fields[0]]:
+			reason = "it is at an excluded ref"
+		default:
+			continue
+		}
+		if err := m.run(m.gitCommand(ctx, dir, "branch", "-D", b), out); err != nil {
+			lastErr = err
+			continue
+		}
+		_, _ = fmt.Fprintf(out, "Pruned %s, %s\n", b, reason)
+		m.events.Printf("%s: pruned the branch %s, %s", project.Name, b, reason)
+	}
+	return lastErr
+}
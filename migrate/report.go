@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"sort"
+	"time"
+)
+
+// Report summarizes a run, as it is when Report is called
+type Report struct {
+	Complete int              `json:"complete"`
+	Total    int              `json:"total"`
+	Failed   int              `json:"failed"`
+	Empty    int              `json:"empty"`
+	Running  []RunningProject `json:"running,omitempty"`
+	Projects []ProjectReport  `json:"projects"`
+}
+
+// RunningProject is a project that has started but not yet finished
+type RunningProject struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+}
+
+// ProjectReport is the outcome of one finished project
+type ProjectReport struct {
+	Name          string    `json:"name"`
+	SVN           string    `json:"svn"`
+	Status        string    `json:"status"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	Duration      string    `json:"duration"`
+	Skipped       bool      `json:"skipped"`
+	Empty         bool      `json:"empty"`
+	Pushed        string    `json:"pushed,omitempty"`
+	SVNRevisions  int       `json:"svn_revisions,omitempty"`
+	ShallowFrom   int       `json:"shallow_from,omitempty"`
+	FirstRevision int       `json:"first_revision,omitempty"`
+	LastRevision  int       `json:"last_revision,omitempty"`
+	GitCommits    int       `json:"git_commits,omitempty"`
+	Stage         string    `json:"stage,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	CleanupErrors []string  `json:"cleanup_errors,omitempty"`
+	BasePath      string    `json:"base_path,omitempty"`
+	Bundle        string    `json:"bundle,omitempty"`
+	BundleSHA256  string    `json:"bundle_sha256,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Report summarizes the current or last run of m, it is safe to call while Run is in progress
+func (m *Migrator) Report() Report {
+	q := &m.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r := Report{
+		Complete: q.Complete,
+		Total:    q.Total,
+		Projects: make([]ProjectReport, 0, len(q.Results)),
+	}
+	for _, result := range q.Results {
+		pr := ProjectReport{
+			Name:          result.Project.Name,
+			SVN:           result.Project.SVN,
+			Status:        result.Status(),
+			Start:         result.Start,
+			End:           result.End,
+			Duration:      result.Duration().String(),
+			Skipped:       result.Skipped,
+			Empty:         result.Empty,
+			Pushed:        result.Pushed,
+			SVNRevisions:  result.SVNRevisions,
+			ShallowFrom:   result.ShallowFrom,
+			FirstRevision: result.FirstRevision,
+			LastRevision:  result.LastRevision,
+			GitCommits:    result.GitCommits,
+			BasePath:      result.BasePath,
+			Bundle:        result.Bundle,
+			BundleSHA256:  result.BundleSHA256,
+		}
+		for _, err := range result.CleanupErrors {
+			pr.CleanupErrors = append(pr.CleanupErrors, err.Error())
+		}
+		if result.Err != nil {
+			pr.Stage = result.Stage()
+			pr.Reason = result.Reason()
+			pr.Error = result.Err.Error()
+			r.Failed++
+		} else if result.Empty {
+			r.Empty++
+		}
+		r.Projects = append(r.Projects, pr)
+	}
+	for name, start := range q.Running {
+		r.Running = append(r.Running, RunningProject{Name: name, Start: start})
+	}
+	sort.Slice(r.Running, func(i, j int) bool {
+		return r.Running[i].Name < r.Running[j].Name
+	})
+	return r
+}
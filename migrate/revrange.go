@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// revMapRecord is the size of one record in a git svn .rev_map file, a big-endian revision followed by a commit hash
+const revMapRecord = 4 + 20
+
+// revisionRange is the first and last SVN revision git svn fetched into dir, or zeros if it fetched none
+// It reads the .rev_map files git svn keeps under .git/svn, which exist even without svn metadata in the commits
+func revisionRange(dir string) (first, last int, err error) {
+	root := filepath.Join(dir, ".git", "svn")
+	walk := func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasPrefix(info.Name(), ".rev_map.") {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		zero := make([]byte, 20)
+		for off := 0; off+revMapRecord <= len(data); off += revMapRecord {
+			// git svn pads the map with an empty commit hash for revisions it saw but did not commit
+			if bytes.Equal(data[off+4:off+revMapRecord], zero) {
+				continue
+			}
+			rev := int(binary.BigEndian.Uint32(data[off : off+4]))
+			if first == 0 || rev < first {
+				first = rev
+			}
+			if rev > last {
+				last = rev
+			}
+		}
+		return nil
+	}
+	if err := filepath.Walk(root, walk); err != nil {
+		return 0, 0, err
+	}
+	return first, last, nil
+}
@@ -0,0 +1,109 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// schedulePoll is how often projects waiting for a slot check whether the concurrency_schedule allows more
+const schedulePoll = time.Minute
+
+// ConcurrencyWindow replaces max_concurrency between two times of day, e.g. to migrate less during working hours
+// From and To are local HH:MM times, a window whose To is before its From runs past midnight
+type ConcurrencyWindow struct {
+	From           string `toml:"from" yaml:"from"`
+	To             string `toml:"to" yaml:"to"`
+	MaxConcurrency int    `toml:"max_concurrency" yaml:"max_concurrency"`
+}
+
+// minutes parses an HH:MM time of day into minutes since midnight
+func minutes(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not an HH:MM time", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains is whether the window covers the time of day of now, times that don't parse are caught by Validate
+func (w ConcurrencyWindow) contains(now time.Time) bool {
+	from, _ := minutes(w.From)
+	to, _ := minutes(w.To)
+	at := now.Hour()*60 + now.Minute()
+	if from <= to {
+		return at >= from && at < to
+	}
+	return at >= from || at < to
+}
+
+// concurrency is how many projects may run at now, from the first window of the schedule covering it
+func (c Config) concurrency(now time.Time, fallback int) int {
+	for _, window := range c.ConcurrencySchedule {
+		if window.contains(now) {
+			return window.MaxConcurrency
+		}
+	}
+	return fallback
+}
+
+// stagger waits launch_stagger plus up to launch_jitter between launching projects, so they don't all connect at once
+// Projects that were not launched when ctx is done still are, straight away, and skip themselves
+func (m *Migrator) stagger(ctx context.Context) {
+	wait := m.config.LaunchStagger.Duration
+	if jitter := m.config.LaunchJitter.Duration; jitter > 0 {
+		wait += time.Duration(rand.Int63n(int64(jitter)))
+	}
+	if wait <= 0 || m.DryRun {
+		return
+	}
+	select {
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+}
+
+// slots limits how many projects run at once to a limit that can change over time
+// A lowered limit lets running projects finish, only projects yet to start wait for it
+type slots struct {
+	mu      sync.Mutex
+	running int
+	limit   func(time.Time) int
+	// freed is closed and replaced every time a slot is given back, waking everyone waiting for one
+	freed chan struct{}
+}
+
+func newSlots(limit func(time.Time) int) *slots {
+	return &slots{limit: limit, freed: make(chan struct{})}
+}
+
+// acquire waits for a free slot and returns the func to give it back, or nil if ctx is done first
+func (s *slots) acquire(ctx context.Context) func() {
+	for {
+		s.mu.Lock()
+		if s.running < s.limit(time.Now()) {
+			s.running++
+			s.mu.Unlock()
+			return s.release
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-time.After(schedulePoll):
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *slots) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running--
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
@@ -0,0 +1,88 @@
+package migrate
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Names the user's cleanup scripts are copied to in base_path
+const (
+	tagsScript     = "tags.sh"
+	branchesScript = "branches.sh"
+	pegsScript     = "pegs.sh"
+)
+
+// cleanupScripts maps the name each configured cleanup script is copied to onto where it is copied from
+func (c Config) cleanupScripts() map[string]string {
+	scripts := make(map[string]string)
+	for name, src := range map[string]string{
+		tagsScript:     c.TagsScript,
+		branchesScript: c.BranchesScript,
+		pegsScript:     c.PegsScript,
+	} {
+		if src != "" {
+			scripts[name] = src
+		}
+	}
+	return scripts
+}
+
+// copyScripts copies every configured cleanup script into base_path, so a run keeps using the scripts it started with
+func (m *Migrator) copyScripts() error {
+	m.scripts = make(map[string]string)
+	for name, src := range m.config.cleanupScripts() {
+		data, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(m.config.BasePath, name)
+		if err := m.config.writeFile(dst, data, m.config.scriptMode()); err != nil {
+			return err
+		}
+		m.scripts[name] = dst
+	}
+	return nil
+}
+
+// cleanScripts removes the copies of the cleanup scripts, unless they are the user's own files
+func (m *Migrator) cleanScripts() error {
+	sources := m.config.cleanupScripts()
+	for name, dst := range m.scripts {
+		if sources[name] == dst {
+			continue
+		}
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bashPath is the configured bash_path, or bash from PATH
+func (m *Migrator) bashPath() string {
+	if m.config.BashPath != "" {
+		return m.config.BashPath
+	}
+	return "bash"
+}
+
+// cleanupStep runs the user's script called name in dir if there is one, and builtin otherwise
+// Scripts get the same MIGRATE_ variables as a post_hook, so they know the prefix of the refs to convert
+func (m *Migrator) cleanupStep(ctx context.Context, project Project, name, dir string, out io.Writer, builtin func(context.Context, Project, string, io.Writer) error) error {
+	script, ok := m.scripts[name]
+	if !ok {
+		switch name {
+		case tagsScript:
+			recordLine(ctx, dir, tagsShell(project))
+		case branchesScript:
+			recordLine(ctx, dir, branchesShell(project, m.Update))
+		case pegsScript:
+			recordLine(ctx, dir, pegsShell())
+		}
+		return builtin(withoutScript(ctx), project, dir, out)
+	}
+	return m.runHook(ctx, project, []string{m.bashPath(), script}, dir, out)
+}
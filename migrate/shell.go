@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+type scriptKey struct{}
+
+// withScript makes every command built by command with ctx also get written to buf as a line of shell
+func withScript(ctx context.Context, buf *bytes.Buffer) context.Context {
+	return context.WithValue(ctx, scriptKey{}, buf)
+}
+
+// recordCommand writes cmd to the script of ctx, if it has one
+// Commands of one project are built one after the other, so the buffer needs no lock
+func recordCommand(ctx context.Context, cmd *exec.Cmd) {
+	recordLine(ctx, cmd.Dir, commandLine(cmd))
+}
+
+// commandLine is cmd as a line of shell
+func commandLine(cmd *exec.Cmd) string {
+	args := make([]string, len(cmd.Args))
+	for idx, arg := range cmd.Args {
+		args[idx] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// envShell is env as assignments to put in front of a command, each followed by a space
+func envShell(env []string) string {
+	var assignments strings.Builder
+	for _, pair := range env {
+		kv := strings.SplitN(pair, "=", 2)
+		_, _ = fmt.Fprintf(&assignments, "%s=%s ", kv[0], shellQuote(kv[1]))
+	}
+	return assignments.String()
+}
+
+// recordLine writes line to the script of ctx as it is, to be run in dir, if ctx has a script
+func recordLine(ctx context.Context, dir, line string) {
+	buf, ok := ctx.Value(scriptKey{}).(*bytes.Buffer)
+	if !ok || buf == nil {
+		return
+	}
+	if dir != "" {
+		_, _ = fmt.Fprintf(buf, "cd %s && ", shellQuote(dir))
+	}
+	_, _ = fmt.Fprintln(buf, line)
+}
+
+// withoutScript keeps the commands built with the returned context out of the script of ctx,
+// for steps that are written to it as shell of their own with recordLine
+func withoutScript(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(scriptKey{}).(*bytes.Buffer); !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, scriptKey{}, (*bytes.Buffer)(nil))
+}
+
+// The built-in cleanup steps decide what to run from the refs the clone made, which a dry run never has,
+// so the script gets shell loops that do the same from whatever refs there are when it runs
+// Refs are listed like refs does, and only those under the prefix of the project are converted
+
+// remoteLoop loops over the git svn refs of project as $r, running body for those under the prefix plus rest
+func remoteLoop(project Project, rest, body string) string {
+	return fmt.Sprintf("for r in $(git for-each-ref --format='%%(refname:short)' refs/remotes); do case \"$r\" in %s%s*) %s;; esac; done",
+		shellQuote(project.Prefix), rest, body)
+}
+
+// tagsShell does what convertTags does
+func tagsShell(project Project) string {
+	return remoteLoop(project, "tags/", fmt.Sprintf(`git tag "${r#%s}" "$r" && git branch -D -r "$r"`, shellQuote(project.Prefix+"tags/")))
+}
+
+// branchesShell does what convertBranches does, moving existing branches forward with -update
+func branchesShell(project Project, update bool) string {
+	convert := fmt.Sprintf(`git branch "${r#%s}" "refs/remotes/$r"`, shellQuote(project.Prefix))
+	if update {
+		convert = fmt.Sprintf(`git update-ref "refs/heads/${r#%s}" "refs/remotes/$r"`, shellQuote(project.Prefix))
+	}
+	return remoteLoop(project, "", convert+` && git branch -D -r "$r"`)
+}
+
+// ifRefShell runs line only if ref exists, like the checks made with hasRef
+func ifRefShell(ref, line string) string {
+	return fmt.Sprintf("if git rev-parse --verify -q %s >/dev/null; then %s; fi", shellQuote(ref), line)
+}
+
+// pegsShell does what deletePegs does
+func pegsShell() string {
+	return `for p in $(git for-each-ref --format='%(refname:short)' | grep @); do git branch -D "$p"; done`
+}
+
+// excludedTips is where the script keeps the commits of excluded refs for pruneShell, inside the .git of the repository
+const excludedTips = ".git/migrate-excluded"
+
+// excludeShell does what excludeRefs does, matching exclude_refs with case, whose * also matches a /
+// With prune, the commits of the excluded refs are kept in excludedTips
+func excludeShell(project Project, prune bool) string {
+	remove := `git branch -D -r "$r"`
+	if prune {
+		remove = `git rev-parse "refs/remotes/$r" >> ` + excludedTips + ` && ` + remove
+	}
+	body := fmt.Sprintf(`case "${r#%s}" in %s) %s;; esac`, shellQuote(project.Prefix), strings.Join(project.ExcludeRefs, "|"), remove)
+	return remoteLoop(project, "", body)
+}
+
+// pruneShell does what pruneBranches does, with the commits excludeShell kept, and removes them after
+func pruneShell() string {
+	return fmt.Sprintf(`head=$(git symbolic-ref --short HEAD); touch %[1]s; for b in $(git for-each-ref --format='%%(refname:short)' refs/heads); do [ "$b" != "$head" ] && { [ "$(git rev-parse "refs/heads/$b^{tree}")" = %[2]s ] || grep -qx "$(git rev-parse "refs/heads/$b")" %[1]s; } && git branch -D "$b"; done; rm -f %[1]s`, excludedTips, emptyTree)
+}
+
+// writeScript appends the commands of project in buf to m.Script, in a subshell so its env and directories stay its own
+// Secrets are hidden the same way as in the logs, so they have to be filled in before the script is run
+func (m *Migrator) writeScript(project Project, env []string, buf *bytes.Buffer, secrets []string) {
+	var block bytes.Buffer
+	_, _ = fmt.Fprintf(&block, "\n# %s\n(\n", project.Name)
+	if project.password() != "" {
+		_, _ = fmt.Fprintf(&block, "# git svn prompts for the password of %s, and svn reads it from stdin with --password-from-stdin\n", project.Username)
+	}
+	for _, pair := range env {
+		kv := strings.SplitN(pair, "=", 2)
+		_, _ = fmt.Fprintf(&block, "export %s=%s\n", kv[0], shellQuote(kv[1]))
+	}
+	_, _ = block.Write(buf.Bytes())
+	_, _ = fmt.Fprintln(&block, ")")
+
+	var w io.Writer = m.Script
+	if len(secrets) > 0 {
+		w = &redactor{w: w, secrets: secrets}
+	}
+	m.scriptMu.Lock()
+	defer m.scriptMu.Unlock()
+	if _, err := w.Write(block.Bytes()); err != nil {
+		m.Logger.Errorf("Could not write the commands of %s to the script: %v", project.Name, err)
+	}
+}
+
+// shellQuote quotes s for a POSIX shell, unless it is made only of characters that need no quoting
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_-./:=@%+,") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
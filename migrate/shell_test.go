@@ -0,0 +1,115 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestScriptCleanup checks that the script written for the cleanup of one repository does the same to a copy of it
+func TestScriptCleanup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the script needs a POSIX shell")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	run := filepath.Join(tmp, "run")
+	replay := filepath.Join(tmp, "replay")
+	for _, dir := range []string{run, replay} {
+		gitSVNClone(t, dir)
+	}
+
+	m := &Migrator{
+		Logger: nopLogger{},
+		config: Config{PruneBranches: true},
+		events: log.New(ioutil.Discard, "", 0),
+	}
+	project := Project{Name: "app", Prefix: "svn/", ExcludeRefs: []string{"dev-*"}}
+	var script bytes.Buffer
+	if errs := m.cleanup(withScript(context.Background(), &script), project, run, ioutil.Discard); len(errs) > 0 {
+		t.Fatalf("cleanup failed: %v", errs)
+	}
+
+	replayed := strings.Replace(script.String(), "cd "+shellQuote(run)+" ", "cd "+shellQuote(replay)+" ", -1)
+	cmd := exec.Command("sh", "-e")
+	cmd.Stdin = strings.NewReader(replayed)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("replaying the script failed: %v\n%s\n%s", err, replayed, out)
+	}
+
+	want, got := refList(t, run), refList(t, replay)
+	if want != got {
+		t.Errorf("the script left refs\n%s\nbut cleanup left\n%s", got, want)
+	}
+	for _, ref := range []string{"refs/tags/1.0", "refs/heads/feature"} {
+		if !strings.Contains(want, ref+" ") {
+			t.Errorf("cleanup left no %s, refs are\n%s", ref, want)
+		}
+	}
+	for _, ref := range []string{"refs/heads/empty", "refs/remotes/svn/dev-jdoe", "refs/heads/jdoe", "refs/heads/feature@12", "refs/heads/git-svn"} {
+		if strings.Contains(want, ref+" ") {
+			t.Errorf("cleanup left %s, refs are\n%s", ref, want)
+		}
+	}
+}
+
+// gitSVNClone makes a repository in dir with the refs git svn would leave under the prefix svn/,
+// including a peg-revision, a ref for exclude_refs with a local branch at it, an empty branch, and a ref under another prefix
+func gitSVNClone(t *testing.T, dir string) {
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		// Fixed dates keep the commits of both repositories the same
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_DATE=2020-01-01T00:00:00Z", "GIT_COMMITTER_DATE=2020-01-01T00:00:00Z")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "-q")
+	if err := ioutil.WriteFile(filepath.Join(dir, "README"), []byte("app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	git("add", "README")
+	git("commit", "-q", "-m", "r1")
+	git("branch", "git-svn")
+	for _, ref := range []string{"tags/1.0", "feature", "feature@12"} {
+		git("update-ref", "refs/remotes/svn/"+ref, "HEAD")
+	}
+	// The excluded ref has a commit of its own, with a local branch left at it
+	dev := git("commit-tree", "HEAD^{tree}", "-p", "HEAD", "-m", "dev")
+	git("update-ref", "refs/remotes/svn/dev-jdoe", dev)
+	git("update-ref", "refs/heads/jdoe", dev)
+	git("update-ref", "refs/remotes/other/feature", "HEAD")
+	git("update-ref", "refs/remotes/svn/empty", git("commit-tree", emptyTree, "-m", "empty"))
+}
+
+// refList is every ref of the repository in dir with what it points to, one per line
+func refList(t *testing.T, dir string) string {
+	cmd := exec.Command("git", "for-each-ref", "--format=%(refname) %(objectname)")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
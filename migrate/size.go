@@ -0,0 +1,65 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync/atomic"
+	"time"
+)
+
+// sizePoll is how often a running clone is measured against max_repo_size
+const sizePoll = 30 * time.Second
+
+// watchSize measures the .git of dir while it is cloned, and calls cancel once it grows past max_repo_size
+// The returned func stops watching, measures once more, and returns the size if it was over the limit or 0 if not
+func (m *Migrator) watchSize(ctx context.Context, dir string, cancel context.CancelFunc) func() int64 {
+	limit := m.config.MaxRepoSize
+	if limit <= 0 || m.DryRun {
+		return func() int64 { return 0 }
+	}
+	gitDir := path.Join(dir, ".git")
+
+	var over int64
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-time.After(sizePoll):
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+			// A clone that hasn't made .git yet has nothing to measure
+			if size, err := dirSize(gitDir); err == nil && size > limit {
+				atomic.StoreInt64(&over, size)
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return func() int64 {
+		close(done)
+		<-stopped
+		if size := atomic.LoadInt64(&over); size > 0 {
+			return size
+		}
+		if size, err := dirSize(gitDir); err == nil && size > limit {
+			return size
+		}
+		return 0
+	}
+}
+
+// sizeError is the error of a project whose .git grew to size, past max_repo_size
+func (m *Migrator) sizeError(size int64) error {
+	return &StageError{
+		Stage:  StageClone,
+		Reason: "the repository is over max_repo_size",
+		Err:    fmt.Errorf(".git is %d bytes, the limit is %d, leave large paths out with ignore_paths", size, m.config.MaxRepoSize),
+	}
+}
@@ -0,0 +1,50 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lastChanged asks svn when the url of project last had a commit
+func lastChanged(ctx context.Context, project Project) (time.Time, error) {
+	stdout, err := projectSVN(ctx, project, "info", "--show-item", "last-changed-date").Output()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, strings.TrimSpace(string(stdout)))
+}
+
+// headRevision asks svn for the youngest revision of the repository project is in
+func headRevision(ctx context.Context, project Project) (int, error) {
+	stdout, err := projectSVN(ctx, project, "info", "--show-item", "revision").Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(stdout)))
+}
+
+// svnInfo asks svn about the url of project, to check that it exists and can be read
+func svnInfo(ctx context.Context, project Project) error {
+	// svn explains what went wrong on stderr, which is more use than its exit status
+	output, err := projectSVN(ctx, project, "info").CombinedOutput()
+	if msg := strings.TrimSpace(string(output)); err != nil && msg != "" {
+		return fmt.Errorf("%v: %s", err, msg)
+	}
+	return err
+}
+
+// standardLayout is whether the url of project has trunk, branches, and tags directories
+func standardLayout(ctx context.Context, project Project) (bool, error) {
+	stdout, err := projectSVN(ctx, project, "ls").Output()
+	if err != nil {
+		return false, err
+	}
+	found := make(map[string]bool)
+	for _, entry := range strings.Fields(string(stdout)) {
+		found[entry] = true
+	}
+	return found["trunk/"] && found["branches/"] && found["tags/"], nil
+}
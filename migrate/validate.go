@@ -0,0 +1,212 @@
+package migrate
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// validationError lists every problem found with a config
+type validationError []string
+
+func (v validationError) Error() string {
+	return "invalid config:\n\t" + strings.Join(v, "\n\t")
+}
+
+// Validate checks that config is complete enough to start migrating
+func Validate(config Config) error {
+	var problems validationError
+
+	if config.BasePath == "" {
+		problems = append(problems, "base_path is required")
+	} else if fi, err := os.Stat(config.BasePath); err != nil {
+		// A missing base_path is created when the run starts
+		if !os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("base_path: %v", err))
+		}
+	} else if !fi.IsDir() {
+		problems = append(problems, fmt.Sprintf("base_path %s is not a directory", config.BasePath))
+	}
+
+	// users_path is opened after changing into base_path, so relative paths are relative to it
+	if config.UsersPath != "" {
+		usersPath := config.UsersPath
+		if !filepath.IsAbs(usersPath) {
+			usersPath = filepath.Join(config.BasePath, usersPath)
+		}
+		if _, err := os.Stat(usersPath); err != nil {
+			problems = append(problems, fmt.Sprintf("users_path: %v", err))
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, base := range config.BasePaths {
+		switch fi, err := os.Stat(base); {
+		case base == "":
+			problems = append(problems, "base_paths can not have an empty path")
+		case seen[base]:
+			problems = append(problems, fmt.Sprintf("base_paths has %s more than once", base))
+		case err != nil:
+			// Like base_path, missing base paths are created when the run starts
+			if !os.IsNotExist(err) {
+				problems = append(problems, fmt.Sprintf("base_paths: %v", err))
+			}
+		case !fi.IsDir():
+			problems = append(problems, fmt.Sprintf("base path %s is not a directory", base))
+		}
+		seen[base] = true
+	}
+	switch config.BalanceBy {
+	case "", balanceRoundRobin, balanceFreeSpace:
+	default:
+		problems = append(problems, fmt.Sprintf("balance_by %s is not %s or %s", config.BalanceBy, balanceRoundRobin, balanceFreeSpace))
+	}
+
+	if config.FileMode != "" {
+		if _, err := parseFileMode(config.FileMode); err != nil {
+			problems = append(problems, fmt.Sprintf("file_mode %s is not an octal mode such as 0640", config.FileMode))
+		}
+	}
+
+	// Cleanup scripts are relative to base_path like users_path
+	for _, script := range []struct{ key, path string }{
+		{"tags_script", config.TagsScript},
+		{"branches_script", config.BranchesScript},
+		{"pegs_script", config.PegsScript},
+	} {
+		if script.path == "" {
+			continue
+		}
+		scriptPath := script.path
+		if !filepath.IsAbs(scriptPath) {
+			scriptPath = filepath.Join(config.BasePath, scriptPath)
+		}
+		if _, err := os.Stat(scriptPath); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", script.key, err))
+		}
+	}
+
+	for idx, window := range config.ConcurrencySchedule {
+		for _, clock := range []string{window.From, window.To} {
+			if _, err := minutes(clock); err != nil {
+				problems = append(problems, fmt.Sprintf("concurrency_schedule #%d: %v", idx+1, err))
+			}
+		}
+		if window.MaxConcurrency < 1 {
+			problems = append(problems, fmt.Sprintf("concurrency_schedule #%d needs a max_concurrency of at least 1", idx+1))
+		}
+	}
+
+	if len(config.Projects) == 0 {
+		problems = append(problems, "no projects are configured")
+	}
+	names := make(map[string]bool, len(config.Projects))
+	dirs := make(map[string]string, len(config.Projects))
+	for idx, project := range config.Projects {
+		if project.Name == "" {
+			problems = append(problems, fmt.Sprintf("project #%d has no name", idx+1))
+		} else if names[project.Name] {
+			problems = append(problems, fmt.Sprintf("project %s is defined more than once", project.Name))
+		}
+		names[project.Name] = true
+
+		// Two projects in one directory would skip or overwrite each other
+		if project.Name != "" {
+			if other, ok := dirs[project.dirName()]; ok && other != project.Name {
+				problems = append(problems, fmt.Sprintf("projects %s and %s both use the directory %s", other, project.Name, project.dirName()))
+			}
+			dirs[project.dirName()] = project.Name
+		}
+
+		switch {
+		case project.Dump != "" && project.SVN != "":
+			problems = append(problems, fmt.Sprintf("project %s sets both svn and dump", projectLabel(idx, project)))
+		case project.Dump != "":
+			dump := project.Dump
+			if !filepath.IsAbs(dump) {
+				dump = filepath.Join(config.BasePath, dump)
+			}
+			if _, err := os.Stat(dump); err != nil {
+				problems = append(problems, fmt.Sprintf("project %s has an unreadable dump: %v", projectLabel(idx, project), err))
+			}
+		case project.SVN == "":
+			problems = append(problems, fmt.Sprintf("project %s has no svn url", projectLabel(idx, project)))
+		default:
+			if _, err := normalizeURL(project.SVN); err != nil {
+				problems = append(problems, fmt.Sprintf("project %s has an invalid svn url: %v", projectLabel(idx, project), err))
+			}
+		}
+
+		if project.IgnorePaths != "" {
+			if _, err := regexp.Compile(project.IgnorePaths); err != nil {
+				problems = append(problems, fmt.Sprintf("project %s has invalid ignore_paths: %v", projectLabel(idx, project), err))
+			}
+		}
+
+		if project.UsersPath != "" {
+			usersPath := project.UsersPath
+			if !filepath.IsAbs(usersPath) {
+				usersPath = filepath.Join(config.BasePath, usersPath)
+			}
+			if _, err := os.Stat(usersPath); err != nil {
+				problems = append(problems, fmt.Sprintf("project %s has an unreadable users_path: %v", projectLabel(idx, project), err))
+			}
+		}
+
+		for _, pattern := range project.ExcludeRefs {
+			if _, err := path.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("project %s has an invalid exclude_refs pattern %s: %v", projectLabel(idx, project), pattern, err))
+			}
+		}
+	}
+
+	problems = append(problems, unknownDependencies(config.Projects)...)
+	for _, cycle := range dependencyCycles(config.Projects) {
+		problems = append(problems, fmt.Sprintf("depends_on has a cycle: %s", cycle))
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+// svnSchemes are the url schemes git svn can clone from
+var svnSchemes = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"svn":     true,
+	"svn+ssh": true,
+	"file":    true,
+}
+
+// normalizeURL checks that raw is a url git svn can clone and trims any trailing slashes
+func normalizeURL(raw string) (string, error) {
+	trimmed := strings.TrimRight(raw, "/")
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" {
+		return "", fmt.Errorf("%s has no scheme, e.g. https://", raw)
+	}
+	if !svnSchemes[strings.ToLower(u.Scheme)] {
+		return "", fmt.Errorf("%s has the unsupported scheme %s", raw, u.Scheme)
+	}
+	if u.Scheme != "file" && u.Host == "" {
+		return "", fmt.Errorf("%s has no host", raw)
+	}
+	return trimmed, nil
+}
+
+// projectLabel names a project in messages, even if it is missing its name
+func projectLabel(idx int, project Project) string {
+	if project.Name != "" {
+		return project.Name
+	}
+	return fmt.Sprintf("#%d", idx+1)
+}
@@ -0,0 +1,45 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "validate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tests := []struct {
+		name      string
+		dependsOn []string
+		want      string
+	}{
+		{name: "known", dependsOn: []string{"lib"}},
+		{name: "misspelled", dependsOn: []string{"lbi"}, want: "project app depends on unknown project lbi"},
+		{name: "cycle", dependsOn: []string{"app"}, want: "depends_on has a cycle: app -> app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				BasePath: tmp,
+				Projects: []Project{
+					{Name: "lib", SVN: "https://svn/lib"},
+					{Name: "app", SVN: "https://svn/app", DependsOn: tt.dependsOn},
+				},
+			}
+			err := Validate(config)
+			switch {
+			case tt.want == "" && err != nil:
+				t.Errorf("Validate() = %v, want no error", err)
+			case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+				t.Errorf("Validate() = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package migrate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// verify compares the number of SVN revisions for project against the commits migrated into dir
+func (m *Migrator) verify(ctx context.Context, project Project, dir string, out io.Writer) (svnRevisions, gitCommits int, err error) {
+	svnRevisions, err = countRevisions(ctx, project, out)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not count svn revisions: %v", err)
+	}
+
+	// --all would also count the commit of the migration note under refs/notes, which has no svn revision
+	count := m.gitCommand(ctx, dir, "rev-list", "--count", "--branches", "--tags", "--remotes")
+	count.Stderr = out
+	stdout, err := count.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not count git commits: %v", err)
+	}
+	gitCommits, err = strconv.Atoi(strings.TrimSpace(string(stdout)))
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not count git commits: %v", err)
+	}
+
+	_, _ = fmt.Fprintf(out, "Verify: %d svn revisions, %d git commits\n", svnRevisions, gitCommits)
+	diff := svnRevisions - gitCommits
+	if diff < 0 {
+		diff = -diff
+	}
+	if diff > m.config.VerifyTolerance {
+		return svnRevisions, gitCommits, fmt.Errorf("svn has %d revisions but git has %d commits", svnRevisions, gitCommits)
+	}
+	return svnRevisions, gitCommits, nil
+}
+
+// countRevisions counts the revisions svn log reports for project, within its revision range if it has one
+func countRevisions(ctx context.Context, project Project, out io.Writer) (int, error) {
+	args := []string{"log", "--quiet"}
+	if project.Revision != "" {
+		args = append(args, "--revision", project.Revision)
+	}
+
+	cmd := projectSVN(ctx, project, args...)
+	cmd.Stderr = out
+	_, _ = fmt.Fprintf(out, "%s\n", strings.Join(cmd.Args, " "))
+	stdout, err := cmd.Output()
+	if err != nil {
+		return 0, err
+	}
+
+	var revisions int
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		if strings.HasPrefix(scanner.Text(), "r") {
+			revisions++
+		}
+	}
+	return revisions, scanner.Err()
+}
@@ -0,0 +1,78 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookClient gives up quickly, an unreachable webhook must not hold up the run
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// finishedEvent is posted to webhook_url once every project is done
+type finishedEvent struct {
+	Event     string   `json:"event"`
+	Total     int      `json:"total"`
+	Succeeded int      `json:"succeeded"`
+	Empty     int      `json:"empty"`
+	Failed    []string `json:"failed"`
+	Duration  string   `json:"duration"`
+}
+
+// failedEvent is posted to webhook_url as each project fails, with webhook_failures
+type failedEvent struct {
+	Event   string `json:"event"`
+	Project string `json:"project"`
+	Error   string `json:"error"`
+}
+
+// newFinishedEvent summarizes results for the finished webhook
+func newFinishedEvent(results Results, elapsed time.Duration) finishedEvent {
+	failed, empty := results.Failed(), results.Empty()
+	event := finishedEvent{
+		Event:     "finished",
+		Total:     len(results),
+		Succeeded: len(results) - len(failed) - len(empty),
+		Empty:     len(empty),
+		Failed:    []string{},
+		Duration:  elapsed.Round(time.Second).String(),
+	}
+	for _, result := range failed {
+		event.Failed = append(event.Failed, result.Project.Name)
+	}
+	return event
+}
+
+// notify posts event as JSON to the webhook_url, if there is one
+// Failures are only logged, the webhook is a courtesy and never fails the run
+func (m *Migrator) notify(name string, event interface{}) {
+	if m.config.WebhookURL == "" {
+		return
+	}
+	if m.DryRun {
+		m.Logger.Infof("Would notify %s that %s", m.config.WebhookURL, name)
+		return
+	}
+	if err := postWebhook(m.config.WebhookURL, event); err != nil {
+		m.Logger.Errorf("Could not notify the webhook: %v", err)
+		m.events.Printf("error: could not notify the webhook: %v", err)
+	}
+}
+
+func postWebhook(url string, event interface{}) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	resp, err := webhookClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-migrate/migrate"
+	"net/http"
+	"os"
+	"time"
+)
+
+// writeReport saves r as JSON to file, with the file_mode of config
+func writeReport(file string, r migrate.Report, config migrate.Config) error {
+	data, err := json.MarshalIndent(r, "", "\t")
+	if err != nil {
+		return err
+	}
+	return config.WriteFile(file, data)
+}
+
+// createScript creates the executable file of -script-out, starting with its shebang
+// The migrator writes to it unbuffered, so it is complete up to the last finished project even if the run exits early
+func createScript(file string, config migrate.Config) (*os.File, error) {
+	script, err := config.CreateExecutable(file)
+	if err != nil {
+		return nil, err
+	}
+	header := fmt.Sprintf("#!/bin/sh\n# The commands of a go-migrate run at %s, hidden secrets must be filled in\n", time.Now().Format(time.RFC3339))
+	if _, err := script.WriteString(header); err != nil {
+		script.Close()
+		return nil, err
+	}
+	return script, nil
+}
+
+// serveStatus starts serving the report of m at /status on addr
+func serveStatus(addr string, m *migrate.Migrator) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.Report()); err != nil {
+			logger.Errorf("Could not write status: %v", err)
+		}
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Errorf("Could not serve status: %v", err)
+		}
+	}()
+	return server
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go-migrate/migrate"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// printChecks writes the checklist of -doctor to w and returns how many checks failed
+func printChecks(w io.Writer, checks []migrate.Check) int {
+	var failed int
+	for _, check := range checks {
+		if check.Err != nil {
+			failed++
+			_, _ = fmt.Fprintf(w, "[FAIL] %s: %v\n", check.Name, check.Err)
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "[ OK ] %s\n", check.Name)
+	}
+	return failed
+}
+
+// printReconciliation writes each group of r with the projects or directories in it to w, leaving out empty groups
+func printReconciliation(w io.Writer, r migrate.Reconciliation) {
+	incomplete := make([]string, 0, len(r.Incomplete))
+	for _, project := range r.Incomplete {
+		incomplete = append(incomplete, project.Name+": "+project.Reason)
+	}
+	groups := []struct {
+		title string
+		names []string
+	}{
+		{"Migrated", r.Migrated},
+		{"Incomplete, -force migrates the git repositories again", incomplete},
+		{"Pending, no directory yet", r.Pending},
+		{"Missing, in the manifest but without a directory, use -reset or -force to migrate again", r.Missing},
+		{"Orphans, directories without a project", r.Orphans},
+	}
+	for _, group := range groups {
+		if len(group.names) == 0 {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "%s (%d):\n", group.title, len(group.names))
+		for _, name := range group.names {
+			_, _ = fmt.Fprintf(w, "  %s\n", name)
+		}
+	}
+}
+
+// printSummary writes a table of every result to w, with failed rows in red if color is set
+// The table is aligned first and colored after, since tabwriter would count the escape codes as text
+// A BASE PATH column is added when projects were spread across base_paths, a PUSHED column when they were pushed,
+// and a BUNDLE SHA-256 column when they were bundled
+func printSummary(w io.Writer, results migrate.Results, color bool) {
+	spread, pushed, bundled := false, false, false
+	for _, result := range results {
+		spread = spread || result.BasePath != ""
+		pushed = pushed || result.Pushed != ""
+		bundled = bundled || result.BundleSHA256 != ""
+	}
+
+	var buf bytes.Buffer
+	tw := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	header := "NAME\tSTATUS\tDURATION\tREVISIONS\t"
+	if spread {
+		header += "BASE PATH\t"
+	}
+	if pushed {
+		header += "PUSHED\t"
+	}
+	if bundled {
+		header += "BUNDLE SHA-256\t"
+	}
+	_, _ = fmt.Fprintln(tw, header+"ERROR")
+	for _, result := range results {
+		errMsg := ""
+		if result.Err != nil {
+			errMsg = result.Err.Error()
+		} else if len(result.CleanupErrors) > 0 {
+			errMsg = "cleanup: " + result.CleanupErrors[0].Error()
+		}
+		revisions := ""
+		if result.LastRevision > 0 {
+			revisions = fmt.Sprintf("r%d-r%d", result.FirstRevision, result.LastRevision)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t", result.Project.Name, result.Status(), result.Duration().Round(time.Second), revisions)
+		if spread {
+			_, _ = fmt.Fprintf(tw, "%s\t", result.BasePath)
+		}
+		if pushed {
+			_, _ = fmt.Fprintf(tw, "%s\t", result.Pushed)
+		}
+		if bundled {
+			_, _ = fmt.Fprintf(tw, "%s\t", result.BundleSHA256)
+		}
+		_, _ = fmt.Fprintln(tw, errMsg)
+	}
+	_ = tw.Flush()
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+	for idx, line := range lines {
+		// The first line is the header, results start on the second
+		if color && idx > 0 && idx <= len(results) && results[idx-1].Err != nil {
+			line = "\033[31m" + strings.TrimSuffix(line, "\n") + "\033[0m\n"
+		}
+		_, _ = io.WriteString(w, line)
+	}
+}